@@ -0,0 +1,263 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogerwesterbo/ebpf-testing/internal/config"
+	"github.com/rogerwesterbo/ebpf-testing/internal/procfs"
+	"github.com/rogerwesterbo/ebpf-testing/pkg/ebpf"
+)
+
+// agentConfig is the effective configuration after flag and env resolution
+type agentConfig struct {
+	EBPF        ebpf.Config
+	MetricsAddr string
+	HealthAddr  string
+	GRPCAddr    string
+	Interval    time.Duration
+	WarmupDelay time.Duration
+	ProcRoot    string
+	SelfTest    bool
+	Debug       bool
+	MaxReloads  int
+	BPFFSPath   string
+	ReadyFile   string
+	NodeLabel   bool
+	PodLabels   bool
+	MinEntries  int
+
+	// RebuildThreshold consecutive liveness failures rebuild the whole
+	// pipeline, at most once per RebuildCooldown; 0 disables rebuilds
+	RebuildThreshold int
+	RebuildCooldown  time.Duration
+
+	// Pushgateway credentials are only read from the environment
+	PushURL      string
+	PushUsername string
+	PushPassword string
+}
+
+// parseConfig resolves the configuration from args, falling back to
+// environment variables, then the -config file and then built-in defaults
+func parseConfig(args []string, getenv func(string) string) (agentConfig, error) {
+	path := configPath(args, getenv)
+	var file config.File
+	if path != "" {
+		var err error
+		if file, err = config.Load(path); err != nil {
+			return agentConfig{}, err
+		}
+	}
+
+	def := ebpf.DefaultConfig()
+	env := func(key, fallback string) string {
+		if v := getenv(key); v != "" {
+			return v
+		}
+		return fallback
+	}
+	envBool := func(key string, fallback bool) bool {
+		if v := getenv(key); v != "" {
+			return v == "true"
+		}
+		return fallback
+	}
+	envInt := func(key string, fallback int) (int, error) {
+		v := getenv(key)
+		if v == "" {
+			return fallback, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", key, err)
+		}
+		return n, nil
+	}
+
+	interval, err := time.ParseDuration(env("COLLECT_INTERVAL", orString(file.Metrics.Interval, "5s")))
+	if err != nil {
+		return agentConfig{}, fmt.Errorf("COLLECT_INTERVAL: %w", err)
+	}
+	warmupDelay, err := time.ParseDuration(env("WARMUP_DELAY", orString(file.Metrics.WarmupDelay, "0s")))
+	if err != nil {
+		return agentConfig{}, fmt.Errorf("WARMUP_DELAY: %w", err)
+	}
+	rebuildCooldown, err := time.ParseDuration(env("REBUILD_COOLDOWN", orString(file.Health.RebuildCooldown, "5m")))
+	if err != nil {
+		return agentConfig{}, fmt.Errorf("REBUILD_COOLDOWN: %w", err)
+	}
+	maxReloads, err := envInt("MAX_RELOADS", orInt(file.EBPF.MaxReloads, 0))
+	if err != nil {
+		return agentConfig{}, err
+	}
+	minEntries, err := envInt("READY_MIN_ENTRIES", orInt(file.Health.ReadyMinEntries, 0))
+	if err != nil {
+		return agentConfig{}, err
+	}
+	rebuildThreshold, err := envInt("REBUILD_THRESHOLD", orInt(file.Health.RebuildThreshold, 0))
+	if err != nil {
+		return agentConfig{}, err
+	}
+	metricsAddr := ":9090"
+	if file.Server.MetricsAddr != nil {
+		metricsAddr = *file.Server.MetricsAddr
+	}
+
+	cfg := agentConfig{
+		EBPF:         def,
+		PushUsername: getenv("PUSHGATEWAY_USERNAME"),
+		PushPassword: getenv("PUSHGATEWAY_PASSWORD"),
+	}
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	fs.String("config", path, "YAML or JSON config file; flags and env vars take precedence")
+	// selftest is a one-shot run mode rather than a setting, so it has no env or file override
+	fs.BoolVar(&cfg.SelfTest, "selftest", false, "load, attach, collect once and exit")
+	fs.BoolVar(&cfg.Debug, "debug", envBool("DEBUG_ENDPOINTS", orBool(file.Debug, false)), "serve /debug endpoints on the health server")
+	fs.StringVar(&cfg.ProcRoot, "proc-root", env("PROC_ROOT", orString(file.ProcRoot, procfs.DefaultRoot)), "proc filesystem root used to resolve process names")
+	fs.StringVar(&cfg.EBPF.ObjectPath, "object", env("EBPF_OBJECT_PATH", orString(file.EBPF.Object, def.ObjectPath)), "path to the BPF object file")
+	fs.StringVar(&cfg.EBPF.ProgramName, "program", env("EBPF_PROGRAM", orString(file.EBPF.Program, def.ProgramName)), "name of the BPF program to attach")
+	fs.StringVar(&cfg.EBPF.MapName, "map", env("EBPF_MAP", orString(file.EBPF.Map, def.MapName)), "name of the counts map")
+	fs.StringVar(&cfg.EBPF.KprobeSymbol, "kprobe", env("EBPF_KPROBE_SYMBOL", orString(file.EBPF.Kprobe, def.KprobeSymbol)), "kernel symbol to attach the kprobe to")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", env("METRICS_ADDR", metricsAddr), "metrics server listen address")
+	fs.StringVar(&cfg.HealthAddr, "health-addr", env("HEALTH_ADDR", orString(file.Server.HealthAddr, ":8080")), "health server listen address")
+	fs.StringVar(&cfg.GRPCAddr, "grpc-addr", env("GRPC_ADDR", file.Server.GRPCAddr), "gRPC listen address for streaming counts snapshots (disabled when empty)")
+	fs.IntVar(&cfg.MaxReloads, "max-reloads", maxReloads, "reload attempts when the eBPF subsystem breaks before failing liveness (0 disables)")
+	fs.StringVar(&cfg.PushURL, "push-url", env("PUSHGATEWAY_URL", file.Push.URL), "Pushgateway URL to push metrics to (disabled when empty)")
+	fs.StringVar(&cfg.BPFFSPath, "bpffs", env("BPFFS_PATH", file.Health.BPFFSPath), "require this path to be a mounted bpffs for readiness (disabled when empty)")
+	fs.StringVar(&cfg.ReadyFile, "ready-file", env("READY_FILE", file.Health.ReadyFile), "create this file while ready and remove it otherwise (disabled when empty)")
+	fs.BoolVar(&cfg.NodeLabel, "node-label", envBool("NODE_LABEL", orBool(file.Metrics.NodeLabel, false)), "add a node label with the hostname to per-PID series")
+	fs.BoolVar(&cfg.PodLabels, "pod-labels", envBool("POD_LABELS", orBool(file.Metrics.PodLabels, false)), "add pod_uid and container_id labels from each PID's cgroup to per-PID series")
+	fs.IntVar(&cfg.MinEntries, "ready-min-entries", minEntries, "entries a collection must read before the agent is ready (0 disables)")
+	fs.IntVar(&cfg.RebuildThreshold, "rebuild-threshold", rebuildThreshold, "consecutive liveness failures before the eBPF pipeline is rebuilt (0 disables)")
+	fs.DurationVar(&cfg.RebuildCooldown, "rebuild-cooldown", rebuildCooldown, "minimum time between pipeline rebuilds")
+	fs.DurationVar(&cfg.Interval, "interval", interval, "metrics collection interval")
+	fs.DurationVar(&cfg.WarmupDelay, "warmup-delay", warmupDelay, "delay before the collection loop starts after the program is attached")
+
+	kprobeFallbacks := fs.String("kprobe-fallbacks", env("EBPF_KPROBE_FALLBACKS", strings.Join(file.EBPF.KprobeFallbacks, ",")), "comma-separated kernel symbols tried in order when the kprobe symbol is missing")
+	mapMaxEntries := fs.String("map-max-entries", getenv("EBPF_MAP_MAX_ENTRIES"), "comma-separated name=size overrides of map max_entries, e.g. counts=65536")
+
+	if err := fs.Parse(args); err != nil {
+		return agentConfig{}, err
+	}
+	if *kprobeFallbacks != "" {
+		cfg.EBPF.FallbackKprobeSymbols = strings.Split(*kprobeFallbacks, ",")
+	}
+	cfg.EBPF.MapMaxEntries = file.EBPF.MapMaxEntries
+	if *mapMaxEntries != "" {
+		if cfg.EBPF.MapMaxEntries, err = parseMapSizes(*mapMaxEntries); err != nil {
+			return agentConfig{}, fmt.Errorf("map-max-entries: %w", err)
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return agentConfig{}, err
+	}
+	return cfg, nil
+}
+
+// validate checks the fields the agent can't run without
+func (c agentConfig) validate() error {
+	switch {
+	case c.EBPF.ObjectPath == "":
+		return fmt.Errorf("object: required")
+	case c.EBPF.ProgramName == "":
+		return fmt.Errorf("program: required")
+	case c.EBPF.MapName == "":
+		return fmt.Errorf("map: required")
+	case c.Interval <= 0:
+		return fmt.Errorf("interval: must be positive, got %s", c.Interval)
+	case c.WarmupDelay < 0:
+		return fmt.Errorf("warmup-delay: must not be negative, got %s", c.WarmupDelay)
+	case c.RebuildThreshold < 0:
+		return fmt.Errorf("rebuild-threshold: must not be negative, got %d", c.RebuildThreshold)
+	case c.RebuildThreshold > 0 && c.RebuildCooldown <= 0:
+		return fmt.Errorf("rebuild-cooldown: must be positive, got %s", c.RebuildCooldown)
+	}
+	return nil
+}
+
+// configPath finds the -config value in args before the flags are parsed,
+// falling back to the AGENT_CONFIG environment variable
+func configPath(args []string, getenv func(string) string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return getenv("AGENT_CONFIG")
+}
+
+// parseMapSizes parses a comma-separated list of name=size pairs
+func parseMapSizes(s string) (map[string]uint32, error) {
+	sizes := map[string]uint32{}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q: want name=size", pair)
+		}
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", pair, err)
+		}
+		sizes[name] = uint32(n)
+	}
+	return sizes, nil
+}
+
+// orString returns v, or def when v is empty
+func orString(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// orBool returns *v, or def when v is unset
+func orBool(v *bool, def bool) bool {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+// orInt returns *v, or def when v is unset
+func orInt(v *int, def int) int {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+// String formats the configuration as a single key=value line for logging
+func (c agentConfig) String() string {
+	return fmt.Sprintf(
+		"object_path=%q program=%q map=%q kprobe_symbol=%q kprobe_fallbacks=%q map_max_entries=%v metrics_addr=%q health_addr=%q grpc_addr=%q interval=%s warmup_delay=%s proc_root=%q debug=%t max_reloads=%d push_url=%q push_auth=%t bpffs=%q ready_file=%q node_label=%t pod_labels=%t ready_min_entries=%d rebuild_threshold=%d rebuild_cooldown=%s",
+		c.EBPF.ObjectPath, c.EBPF.ProgramName, c.EBPF.MapName, c.EBPF.KprobeSymbol, c.EBPF.FallbackKprobeSymbols, c.EBPF.MapMaxEntries,
+		c.MetricsAddr, c.HealthAddr, c.GRPCAddr, c.Interval, c.WarmupDelay, c.ProcRoot, c.Debug, c.MaxReloads, redactURL(c.PushURL), c.PushUsername != "", c.BPFFSPath, c.ReadyFile, c.NodeLabel, c.PodLabels, c.MinEntries,
+		c.RebuildThreshold, c.RebuildCooldown,
+	)
+}
+
+// redactURL hides the password of a URL for logging. A URL that can't be
+// parsed is not logged at all, as it could hold anything.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid>"
+	}
+	return u.Redacted()
+}
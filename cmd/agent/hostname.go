@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// hostnameSources are the lookups used by hostname, replaceable for tests
+type hostnameSources struct {
+	osHostname func() (string, error)
+	readFile   func(string) ([]byte, error)
+	getenv     func(string) string
+}
+
+// defaultHostnameSources reads from the OS
+var defaultHostnameSources = hostnameSources{
+	osHostname: os.Hostname,
+	readFile:   os.ReadFile,
+	getenv:     os.Getenv,
+}
+
+// hostname returns the node name for const labels
+func hostname() string {
+	return defaultHostnameSources.hostname()
+}
+
+// hostname tries os.Hostname, then /etc/hostname, then $HOSTNAME, and
+// finally returns "unknown" so a lookup failure never stops the agent
+func (s hostnameSources) hostname() string {
+	name, err := s.osHostname()
+	if err == nil && name != "" {
+		return name
+	}
+	log.Printf("Failed to get hostname from the kernel, trying fallbacks: %v", err)
+
+	if data, err := s.readFile("/etc/hostname"); err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			return name
+		}
+	}
+	if name := s.getenv("HOSTNAME"); name != "" {
+		return name
+	}
+
+	log.Printf("Failed to determine hostname, using \"unknown\"")
+	return "unknown"
+}
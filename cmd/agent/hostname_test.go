@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHostnameFallbacks(t *testing.T) {
+	failHostname := func() (string, error) { return "", errors.New("uname failed") }
+	noFile := func(string) ([]byte, error) { return nil, errors.New("no such file") }
+	tests := []struct {
+		name string
+		src  hostnameSources
+		want string
+	}{
+		{
+			name: "kernel",
+			src:  hostnameSources{osHostname: func() (string, error) { return "node-1", nil }},
+			want: "node-1",
+		},
+		{
+			name: "etc hostname",
+			src: hostnameSources{
+				osHostname: failHostname,
+				readFile:   func(string) ([]byte, error) { return []byte("node-2\n"), nil },
+			},
+			want: "node-2",
+		},
+		{
+			name: "environment",
+			src: hostnameSources{
+				osHostname: failHostname,
+				readFile:   noFile,
+				getenv:     func(string) string { return "node-3" },
+			},
+			want: "node-3",
+		},
+		{
+			name: "unknown",
+			src: hostnameSources{
+				osHostname: failHostname,
+				readFile:   noFile,
+				getenv:     func(string) string { return "" },
+			},
+			want: "unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.src.hostname(); got != tt.want {
+				t.Fatalf("hostname() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// logLevel is the level of the default slog logger, adjustable at runtime
+var logLevel = new(slog.LevelVar)
+
+// logLevelHandler reports the log level on GET and sets it on POST from the
+// level query parameter or the request body, e.g. "debug" or "info"
+func logLevelHandler(lv *slog.LevelVar) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			level := r.URL.Query().Get("level")
+			if level == "" {
+				body, err := io.ReadAll(io.LimitReader(r.Body, 64))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				level = strings.TrimSpace(string(body))
+			}
+			if err := lv.UnmarshalText([]byte(level)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			slog.Info("Log level changed", "level", lv.Level())
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		_, _ = fmt.Fprintln(w, lv.Level())
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	lv := new(slog.LevelVar)
+	h := logLevelHandler(lv)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := serve(http.MethodGet, "/debug/loglevel", ""); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "INFO" {
+		t.Fatalf("GET = %d %q, want INFO", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodPost, "/debug/loglevel?level=debug", ""); rec.Code != http.StatusOK || lv.Level() != slog.LevelDebug {
+		t.Fatalf("POST ?level=debug = %d, level %s", rec.Code, lv.Level())
+	}
+	if rec := serve(http.MethodPost, "/debug/loglevel", "warn\n"); rec.Code != http.StatusOK || lv.Level() != slog.LevelWarn {
+		t.Fatalf("POST body warn = %d, level %s", rec.Code, lv.Level())
+	}
+	if rec := serve(http.MethodPost, "/debug/loglevel", "loud"); rec.Code != http.StatusBadRequest || lv.Level() != slog.LevelWarn {
+		t.Fatalf("POST loud = %d, level %s; want 400 and no change", rec.Code, lv.Level())
+	}
+	if rec := serve(http.MethodPut, "/debug/loglevel", "info"); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, POST" {
+		t.Fatalf("PUT = %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
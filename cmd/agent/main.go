@@ -1,71 +1,253 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rogerwesterbo/ebpf-testing/internal/procfs"
 	"github.com/rogerwesterbo/ebpf-testing/pkg/ebpf"
 	"github.com/rogerwesterbo/ebpf-testing/pkg/health"
 	"github.com/rogerwesterbo/ebpf-testing/pkg/metrics"
 	"github.com/rogerwesterbo/ebpf-testing/pkg/server"
+	"github.com/rogerwesterbo/ebpf-testing/pkg/stream"
 )
 
 func main() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+
+	cfg, err := parseConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	log.Printf("Effective config: %s", cfg)
+
+	// Fail fast on a misconfigured proc mount rather than labeling everything "unknown"
+	if err := procfs.WaitForRoot(cfg.ProcRoot, 3, time.Second); err != nil {
+		log.Fatalf("Invalid proc root: %v", err)
+	}
+	procfs.SetRoot(cfg.ProcRoot)
+
+	if cfg.SelfTest {
+		err := runSelfTest(os.Stdout,
+			func() (selfTestManager, error) {
+				return ebpf.NewManager(cfg.EBPF)
+			},
+			func(m selfTestManager) (selfTestCollector, error) {
+				return metrics.NewCollector(metrics.Config{CountsMap: m.GetCountsMap()})
+			},
+		)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "self-test FAILED: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("self-test passed")
+		return
+	}
+
+	// Cancel on shutdown signals from here on, including during eBPF load
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	ctx, cancel := cancelOnSignal(context.Background(), sig)
+	defer cancel()
+
 	// Initialize health checker
 	healthChecker := health.NewChecker()
+	if cfg.BPFFSPath != "" {
+		healthChecker.AddReadinessCheck("bpffs", health.NewBPFFSCheck(cfg.BPFFSPath))
+	}
+	// Clears a file left behind by an unclean exit, since the agent isn't ready yet
+	if err := healthChecker.SetReadinessFile(cfg.ReadyFile); err != nil {
+		log.Fatalf("Invalid readiness file: %v", err)
+	}
+
+	features := ebpf.DetectFeatures()
+	log.Printf("Kernel features: %s", features)
+	if !features.Capabilities.CanLoad() {
+		log.Printf("Warning: missing CAP_SYS_ADMIN or CAP_BPF+CAP_PERFMON, loading will likely fail")
+	}
+
+	var constLabels prometheus.Labels
+	if cfg.NodeLabel {
+		constLabels = prometheus.Labels{"node": hostname()}
+	}
 
-	// Load and attach eBPF program
+	// Load and attach eBPF program, then start collecting from it
 	log.Println("Loading eBPF program...")
-	ebpfMgr, err := ebpf.NewManager(ebpf.DefaultConfig())
+	// Loads are timed before the metrics are registered and published below
+	loadMetrics := metrics.NewLoadMetrics()
+	cfg.EBPF.OnLoad = loadMetrics.Observe
+	var current currentPipeline
+	first, err := newPipeline(ctx, cfg, healthChecker, constLabels)
+	if errors.Is(err, context.Canceled) {
+		log.Println("Shutdown requested during startup, exiting")
+		return
+	}
 	if err != nil {
-		log.Fatalf("Failed to load eBPF program: %v", err)
+		log.Fatalf("Failed to start eBPF pipeline: %v", err)
 	}
-	defer ebpfMgr.Close()
+	current.set(first)
+	defer func() { current.get().close() }()
+	healthChecker.SetDetailsProvider(health.DetailsFunc(func() (any, error) {
+		return current.get().mgr.Details()
+	}))
 
 	// Mark as ready once eBPF is successfully loaded and attached
 	healthChecker.SetReady(true)
 	log.Println("eBPF program loaded and attached successfully - application is ready")
 
-	// Start metrics collector
-	log.Println("Starting metrics collector...")
-	metricsCollector := metrics.NewCollector(metrics.Config{
-		CountsMap: ebpfMgr.GetCountsMap(),
-		Interval:  5 * time.Second,
-		OnError: func(err error) {
-			log.Printf("Metrics collection error: %v", err)
-			healthChecker.SetAlive(false)
-		},
+	if err := metrics.RegisterStartTime(prometheus.DefaultRegisterer); err != nil {
+		log.Printf("Failed to register start time metric: %v", err)
+	}
+	err = metrics.RegisterBPFStatsEnabled(prometheus.DefaultRegisterer, func() (bool, error) {
+		return ebpf.StatsEnabled(ebpf.StatsEnabledPath)
 	})
-	metricsCollector.Start()
-	defer metricsCollector.Stop()
+	if err != nil {
+		log.Printf("Failed to register bpf stats metric: %v", err)
+	}
+	if err := metrics.RegisterOpenFDs(prometheus.DefaultRegisterer, procfs.OpenFDs); err != nil {
+		log.Printf("Failed to register open fds metric: %v", err)
+	}
+	if err := loadMetrics.Register(prometheus.DefaultRegisterer); err != nil {
+		log.Printf("Failed to register load duration metrics: %v", err)
+	}
+	if err := metrics.RegisterReadySeconds(prometheus.DefaultRegisterer, healthChecker.ReadySince); err != nil {
+		log.Printf("Failed to register ready seconds metric: %v", err)
+	}
+	if first.mgr.GetEvents() != nil {
+		err := metrics.RegisterEventsDropped(prometheus.DefaultRegisterer, func() uint64 {
+			if events := current.get().mgr.GetEvents(); events != nil {
+				return events.Dropped()
+			}
+			return 0
+		})
+		if err != nil {
+			log.Printf("Failed to register events dropped metric: %v", err)
+		}
+	}
+	if cfg.MinEntries > 0 {
+		healthChecker.AddReadinessCheck("min_entries", func() error {
+			return current.get().collector.MinEntriesCheck(cfg.MinEntries)()
+		})
+	}
+	if cfg.ReadyFile != "" {
+		go healthChecker.WatchReadiness(ctx, cfg.Interval)
+	}
+
+	if cfg.RebuildThreshold > 0 {
+		r := &rebuilder{
+			threshold: cfg.RebuildThreshold,
+			cooldown:  cfg.RebuildCooldown,
+			isAlive:   healthChecker.IsAlive,
+			now:       time.Now,
+			rebuild: func() error {
+				// The old pipeline goes first so its metrics can be registered again
+				current.get().close()
+				next, err := newPipeline(ctx, cfg, healthChecker, constLabels)
+				if err != nil {
+					return err
+				}
+				current.set(next)
+				healthChecker.SetAlive(true)
+				return nil
+			},
+		}
+		rebuildDone := make(chan struct{})
+		go func() {
+			defer close(rebuildDone)
+			r.run(ctx, cfg.Interval)
+		}()
+		// Don't close the pipeline under a rebuild in progress
+		defer func() { <-rebuildDone }()
+	}
+
+	var pusher *metrics.Pusher
+	if cfg.PushURL != "" {
+		pusher, err = metrics.NewPusher(metrics.PushConfig{
+			URL:      cfg.PushURL,
+			Username: cfg.PushUsername,
+			Password: cfg.PushPassword,
+		})
+		if err != nil {
+			log.Fatalf("Failed to create pusher: %v", err)
+		}
+		pusher.Start()
+	}
 
 	// Start HTTP servers
 	log.Println("Starting HTTP servers...")
-	serverMgr := server.NewManager(server.Config{
-		MetricsAddr: ":9090",
-		HealthAddr:  ":8080",
-		HealthCheck: healthChecker,
+	debugHandlers := map[string]http.Handler{}
+	if cfg.Debug {
+		debugHandlers["/debug/counts"] = current.handler(func(c *metrics.Collector) http.HandlerFunc { return c.CountsHandler })
+		debugHandlers["/debug/counts.csv"] = current.handler(func(c *metrics.Collector) http.HandlerFunc { return c.CSVHandler })
+		debugHandlers["/debug/collect"] = current.handler(func(c *metrics.Collector) http.HandlerFunc { return c.CollectHandler })
+		debugHandlers["/debug/collector"] = current.handler(func(c *metrics.Collector) http.HandlerFunc { return c.StatusHandler })
+		debugHandlers["/debug/features"] = http.HandlerFunc(ebpf.FeaturesHandler)
+		debugHandlers["/debug/ebpf"] = http.HandlerFunc(healthChecker.DetailsHandler)
+		debugHandlers["/debug/loglevel"] = logLevelHandler(logLevel)
+	}
+
+	serverMgr, err := server.NewManager(server.Config{
+		MetricsAddr:   cfg.MetricsAddr,
+		HealthAddr:    cfg.HealthAddr,
+		HealthCheck:   healthChecker,
+		DebugHandlers: debugHandlers,
 	})
+	if err != nil {
+		log.Fatalf("Failed to create servers: %v", err)
+	}
 
 	if err := serverMgr.Start(); err != nil {
 		log.Fatalf("Failed to start servers: %v", err)
 	}
 
+	var streamServer *stream.Server
+	if cfg.GRPCAddr != "" {
+		streamServer, err = stream.NewServer(stream.Config{
+			Addr: cfg.GRPCAddr,
+			Snapshot: func() []metrics.MapEntry {
+				return current.get().collector.Snapshot()
+			},
+			Interval: cfg.Interval,
+		})
+		if err != nil {
+			log.Fatalf("Failed to create stream server: %v", err)
+		}
+		if err := streamServer.Start(); err != nil {
+			log.Fatalf("Failed to start stream server: %v", err)
+		}
+	}
+
 	// Wait for shutdown signal
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	<-sig
+	<-ctx.Done()
 
 	// Graceful shutdown
 	log.Println("Shutting down...")
 	healthChecker.SetReady(false)
 
-	if err := serverMgr.ShutdownGracefully(10 * time.Second); err != nil {
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	if err := serverMgr.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Server shutdown error: %v", err)
 	}
+	if streamServer != nil {
+		if err := streamServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Stream server shutdown error: %v", err)
+		}
+	}
+	if pusher != nil {
+		if err := pusher.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Final push error: %v", err)
+		}
+	}
 
 	log.Println("Shutdown complete")
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rogerwesterbo/ebpf-testing/pkg/ebpf"
+	"github.com/rogerwesterbo/ebpf-testing/pkg/health"
+	"github.com/rogerwesterbo/ebpf-testing/pkg/metrics"
+)
+
+// pipeline is a loaded eBPF manager with the collector and supervisor using it
+type pipeline struct {
+	mgr        *ebpf.Manager
+	collector  *metrics.Collector
+	supervisor *ebpf.Supervisor
+
+	closeOnce sync.Once
+}
+
+// newPipeline loads the program and starts collecting from it
+func newPipeline(ctx context.Context, cfg agentConfig, checker *health.Checker, constLabels prometheus.Labels) (*pipeline, error) {
+	mgr, err := ebpf.NewManagerContext(ctx, cfg.EBPF)
+	if err != nil {
+		return nil, err
+	}
+
+	collector, err := metrics.NewCollector(metrics.Config{
+		ConstLabels:     constLabels,
+		CountsMapSource: mgr.GetCountsMap,
+		Interval:        cfg.Interval,
+		WarmupDelay:     cfg.WarmupDelay,
+		PodLabels:       cfg.PodLabels,
+		OnError: func(err error) {
+			log.Printf("Metrics collection error: %v", err)
+			checker.SetAlive(false)
+		},
+		OnCollect: func([]metrics.MapEntry) {
+			checker.SetStarted(true)
+		},
+	})
+	if err != nil {
+		_ = mgr.Close()
+		return nil, err
+	}
+	collector.Start()
+
+	p := &pipeline{mgr: mgr, collector: collector}
+	if cfg.MaxReloads > 0 {
+		p.supervisor = ebpf.NewSupervisor(mgr, supervisorConfig(cfg.MaxReloads, checker, collector.OnMapSwap))
+		p.supervisor.Start()
+	}
+	return p, nil
+}
+
+// supervisorConfig returns the supervisor policy for the pipeline. A
+// successful reload resets the collector baselines and restores the
+// liveness that collection errors on the broken map took away.
+func supervisorConfig(maxReloads int, checker *health.Checker, onMapSwap func()) ebpf.SupervisorConfig {
+	return ebpf.SupervisorConfig{
+		MaxReloads: maxReloads,
+		Backoff:    time.Second,
+		OnGiveUp: func(error) {
+			checker.SetAlive(false)
+		},
+		OnReload: func() {
+			onMapSwap()
+			checker.SetAlive(true)
+		},
+	}
+}
+
+// close stops the pipeline and detaches the program. It is safe to call
+// more than once, e.g. when a rebuild fails after closing its predecessor.
+func (p *pipeline) close() {
+	p.closeOnce.Do(func() {
+		if p.supervisor != nil {
+			p.supervisor.Stop()
+		}
+		p.collector.Stop()
+		p.collector.Unregister()
+		if err := p.mgr.Close(); err != nil {
+			log.Printf("Failed to close eBPF manager: %v", err)
+		}
+	})
+}
+
+// currentPipeline holds the pipeline in use, replaced on every rebuild
+type currentPipeline struct {
+	p atomic.Pointer[pipeline]
+}
+
+// get returns the pipeline in use
+func (c *currentPipeline) get() *pipeline {
+	return c.p.Load()
+}
+
+// set replaces the pipeline in use
+func (c *currentPipeline) set(p *pipeline) {
+	c.p.Store(p)
+}
+
+// handler returns an HTTP handler serving h of the pipeline in use
+func (c *currentPipeline) handler(h func(*metrics.Collector) http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(c.get().collector)(w, r)
+	})
+}
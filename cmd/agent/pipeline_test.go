@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/ebpf-testing/pkg/ebpf"
+	"github.com/rogerwesterbo/ebpf-testing/pkg/health"
+)
+
+// brokenMap is a Reloader whose ping fails until it has been reloaded
+type brokenMap struct {
+	reloaded  atomic.Bool
+	reloadErr error
+}
+
+func (b *brokenMap) Ping() error {
+	if !b.reloaded.Load() {
+		return errors.New("counts map gone")
+	}
+	return nil
+}
+
+func (b *brokenMap) Reload() error {
+	if b.reloadErr != nil {
+		return b.reloadErr
+	}
+	b.reloaded.Store(true)
+	return nil
+}
+
+// supervise runs a supervisor with the pipeline policy against target until
+// done reports true or a second elapses
+func supervise(t *testing.T, target ebpf.Reloader, checker *health.Checker, onMapSwap func(), done func() bool) {
+	t.Helper()
+	cfg := supervisorConfig(1, checker, onMapSwap)
+	cfg.Interval = 5 * time.Millisecond
+	s := ebpf.NewSupervisor(target, cfg)
+	s.Start()
+	defer s.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for !done() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReloadRestoresLiveness(t *testing.T) {
+	checker := health.NewChecker()
+	// The collector's OnError marks the pod not alive on the broken map
+	checker.SetAlive(false)
+
+	var swaps atomic.Int32
+	supervise(t, &brokenMap{}, checker, func() { swaps.Add(1) }, checker.IsAlive)
+	if !checker.IsAlive() {
+		t.Fatal("liveness not restored after a successful reload")
+	}
+	if swaps.Load() != 1 {
+		t.Errorf("collector map swaps = %d, want 1", swaps.Load())
+	}
+}
+
+func TestFailedReloadKeepsLivenessFailing(t *testing.T) {
+	checker := health.NewChecker()
+	target := &brokenMap{reloadErr: errors.New("load failed")}
+	gaveUp := func() bool { return !checker.IsAlive() }
+	supervise(t, target, checker, func() { t.Error("map swapped after a failed reload") }, gaveUp)
+	if checker.IsAlive() {
+		t.Fatal("liveness still passing after the supervisor gave up")
+	}
+}
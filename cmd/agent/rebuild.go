@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// rebuilder tears down and rebuilds the whole pipeline after threshold
+// consecutive failed liveness checks, as a last resort before the pod is
+// restarted. At most one rebuild is attempted per cooldown, successful or
+// not, and the failure count starts over after each one.
+type rebuilder struct {
+	threshold int
+	cooldown  time.Duration
+	isAlive   func() bool
+	rebuild   func() error
+	now       func() time.Time
+
+	failures    int
+	lastRebuild time.Time
+}
+
+// check records one liveness check and rebuilds once the threshold is
+// reached outside the cooldown. It reports whether a rebuild was attempted.
+func (r *rebuilder) check() bool {
+	if r.isAlive() {
+		r.failures = 0
+		return false
+	}
+
+	r.failures++
+	if r.failures < r.threshold {
+		return false
+	}
+	now := r.now()
+	if !r.lastRebuild.IsZero() && now.Sub(r.lastRebuild) < r.cooldown {
+		return false
+	}
+
+	log.Printf("Liveness failed %d consecutive checks, rebuilding pipeline", r.failures)
+	r.failures = 0
+	r.lastRebuild = now
+	if err := r.rebuild(); err != nil {
+		log.Printf("Pipeline rebuild failed: %v", err)
+	} else {
+		log.Println("Pipeline rebuilt")
+	}
+	return true
+}
+
+// run checks liveness every interval until ctx is done
+func (r *rebuilder) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.check()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
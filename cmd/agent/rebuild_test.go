@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRebuilderThresholdAndCooldown(t *testing.T) {
+	now := time.Unix(0, 0)
+	alive := false
+	rebuilds := 0
+	r := &rebuilder{
+		threshold: 3,
+		cooldown:  time.Minute,
+		isAlive:   func() bool { return alive },
+		now:       func() time.Time { return now },
+		rebuild: func() error {
+			rebuilds++
+			return errors.New("still broken")
+		},
+	}
+
+	if r.check() || r.check() {
+		t.Fatal("rebuilt before the threshold")
+	}
+	if !r.check() || rebuilds != 1 {
+		t.Fatalf("third failure: rebuilds = %d, want 1", rebuilds)
+	}
+
+	// The failure count starts over, and the cooldown holds off a second rebuild
+	for range 3 {
+		r.check()
+	}
+	if rebuilds != 1 {
+		t.Fatalf("rebuilt %d times within the cooldown, want 1", rebuilds)
+	}
+
+	now = now.Add(time.Minute)
+	r.check()
+	if rebuilds != 2 {
+		t.Fatalf("rebuilds after the cooldown = %d, want 2", rebuilds)
+	}
+
+	// A passing check resets the count
+	r.check()
+	alive = true
+	r.check()
+	alive = false
+	now = now.Add(time.Hour)
+	r.check()
+	r.check()
+	if rebuilds != 2 {
+		t.Fatalf("rebuilt after a passing check reset the count: rebuilds = %d", rebuilds)
+	}
+}
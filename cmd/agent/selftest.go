@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	cebpf "github.com/cilium/ebpf"
+	"github.com/rogerwesterbo/ebpf-testing/pkg/metrics"
+)
+
+// selfTestManager is the part of the eBPF manager exercised by the self-test
+type selfTestManager interface {
+	GetCountsMap() *cebpf.Map
+	Close() error
+}
+
+// selfTestCollector is the part of the metrics collector exercised by the self-test
+type selfTestCollector interface {
+	CollectNow() ([]metrics.MapEntry, error)
+}
+
+// runSelfTest loads and attaches the program, collects once and tears everything down
+func runSelfTest(
+	w io.Writer,
+	loadManager func() (selfTestManager, error),
+	newCollector func(selfTestManager) (selfTestCollector, error),
+) (err error) {
+	mgr, err := loadManager()
+	if err != nil {
+		return fmt.Errorf("load eBPF program: %w", err)
+	}
+	defer func() {
+		if e := mgr.Close(); e != nil && err == nil {
+			err = fmt.Errorf("detach eBPF program: %w", e)
+		}
+	}()
+
+	collector, err := newCollector(mgr)
+	if err != nil {
+		return fmt.Errorf("create collector: %w", err)
+	}
+
+	entries, err := collector.CollectNow()
+	if err != nil {
+		return fmt.Errorf("collect: %w", err)
+	}
+
+	_, _ = fmt.Fprintf(w, "self-test: read %d entries from map\n", len(entries))
+	return nil
+}
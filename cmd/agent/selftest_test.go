@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	cebpf "github.com/cilium/ebpf"
+	"github.com/rogerwesterbo/ebpf-testing/pkg/metrics"
+)
+
+// fakeSelfTestManager records whether it was closed
+type fakeSelfTestManager struct {
+	closed   bool
+	closeErr error
+}
+
+func (m *fakeSelfTestManager) GetCountsMap() *cebpf.Map { return nil }
+
+func (m *fakeSelfTestManager) Close() error {
+	m.closed = true
+	return m.closeErr
+}
+
+// fakeSelfTestCollector returns fixed collection results
+type fakeSelfTestCollector struct {
+	entries []metrics.MapEntry
+	err     error
+}
+
+func (c fakeSelfTestCollector) CollectNow() ([]metrics.MapEntry, error) { return c.entries, c.err }
+
+func TestRunSelfTest(t *testing.T) {
+	tests := []struct {
+		name      string
+		loadErr   error
+		collector fakeSelfTestCollector
+		closeErr  error
+		want      string
+	}{
+		{name: "passes", collector: fakeSelfTestCollector{entries: make([]metrics.MapEntry, 2)}},
+		{name: "load fails", loadErr: errors.New("no BTF"), want: "load eBPF program: no BTF"},
+		{name: "collect fails", collector: fakeSelfTestCollector{err: errors.New("map closed")}, want: "collect: map closed"},
+		{name: "close fails", closeErr: errors.New("busy"), want: "detach eBPF program: busy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := &fakeSelfTestManager{closeErr: tt.closeErr}
+			var out bytes.Buffer
+			err := runSelfTest(&out,
+				func() (selfTestManager, error) {
+					if tt.loadErr != nil {
+						return nil, tt.loadErr
+					}
+					return mgr, nil
+				},
+				func(selfTestManager) (selfTestCollector, error) { return tt.collector, nil },
+			)
+
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("runSelfTest: %v", err)
+				}
+				if !strings.Contains(out.String(), "read 2 entries") {
+					t.Errorf("output = %q, want the entry count", out.String())
+				}
+			} else if err == nil || err.Error() != tt.want {
+				t.Fatalf("runSelfTest = %v, want %q", err, tt.want)
+			}
+			if tt.loadErr == nil && !mgr.closed {
+				t.Error("manager was not closed")
+			}
+		})
+	}
+}
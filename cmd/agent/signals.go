@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+)
+
+// cancelOnSignal returns a context that is cancelled when the first signal
+// arrives on sig, so in-progress startup work such as loading the eBPF
+// object can be abandoned promptly on shutdown
+func cancelOnSignal(parent context.Context, sig <-chan os.Signal) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case s := <-sig:
+			log.Printf("Received %s", s)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
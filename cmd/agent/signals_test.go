@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCancelOnSignal(t *testing.T) {
+	sig := make(chan os.Signal, 1)
+	ctx, cancel := cancelOnSignal(context.Background(), sig)
+	defer cancel()
+
+	if ctx.Err() != nil {
+		t.Fatal("context cancelled before any signal")
+	}
+	sig <- syscall.SIGTERM
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled after SIGTERM")
+	}
+}
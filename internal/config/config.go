@@ -0,0 +1,136 @@
+// Package config loads the agent configuration from a YAML or JSON file
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the structure of an agent config file. Unset fields keep their
+// defaults, and flags and environment variables override set ones.
+type File struct {
+	EBPF    EBPF    `json:"ebpf" yaml:"ebpf"`
+	Server  Server  `json:"server" yaml:"server"`
+	Metrics Metrics `json:"metrics" yaml:"metrics"`
+	Health  Health  `json:"health" yaml:"health"`
+	Push    Push    `json:"push" yaml:"push"`
+
+	ProcRoot string `json:"proc_root" yaml:"proc_root"`
+	Debug    *bool  `json:"debug" yaml:"debug"`
+}
+
+// EBPF configures the program load and attachment
+type EBPF struct {
+	Object     string `json:"object" yaml:"object"`
+	Program    string `json:"program" yaml:"program"`
+	Map        string `json:"map" yaml:"map"`
+	Kprobe     string `json:"kprobe" yaml:"kprobe"`
+	MaxReloads *int   `json:"max_reloads" yaml:"max_reloads"`
+
+	// KprobeFallbacks are tried in order when Kprobe is missing
+	KprobeFallbacks []string `json:"kprobe_fallbacks" yaml:"kprobe_fallbacks"`
+	// MapMaxEntries resizes maps by name, e.g. {counts: 65536}
+	MapMaxEntries map[string]uint32 `json:"map_max_entries" yaml:"map_max_entries"`
+}
+
+// Server configures the listen addresses
+type Server struct {
+	MetricsAddr *string `json:"metrics_addr" yaml:"metrics_addr"`
+	HealthAddr  string  `json:"health_addr" yaml:"health_addr"`
+	GRPCAddr    string  `json:"grpc_addr" yaml:"grpc_addr"`
+}
+
+// Metrics configures the collector
+type Metrics struct {
+	Interval    string `json:"interval" yaml:"interval"`
+	WarmupDelay string `json:"warmup_delay" yaml:"warmup_delay"`
+	NodeLabel   *bool  `json:"node_label" yaml:"node_label"`
+	PodLabels   *bool  `json:"pod_labels" yaml:"pod_labels"`
+}
+
+// Health configures readiness sub-checks and liveness-triggered rebuilds
+type Health struct {
+	BPFFSPath       string `json:"bpffs_path" yaml:"bpffs_path"`
+	ReadyMinEntries *int   `json:"ready_min_entries" yaml:"ready_min_entries"`
+	ReadyFile       string `json:"ready_file" yaml:"ready_file"`
+
+	RebuildThreshold *int   `json:"rebuild_threshold" yaml:"rebuild_threshold"`
+	RebuildCooldown  string `json:"rebuild_cooldown" yaml:"rebuild_cooldown"`
+}
+
+// Push configures the Pushgateway. Credentials are only read from the environment.
+type Push struct {
+	URL string `json:"url" yaml:"url"`
+}
+
+// Load reads and validates the config file at path. The format is chosen
+// by extension: .yaml or .yml for YAML, .json for JSON.
+func Load(path string) (File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, fmt.Errorf("config: %w", err)
+	}
+
+	var f File
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil {
+			return File{}, fmt.Errorf("config %s: %w", path, err)
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			return File{}, fmt.Errorf("config %s: %w", path, err)
+		}
+	default:
+		return File{}, fmt.Errorf("config %s: unsupported extension %q (want .yaml, .yml or .json)", path, ext)
+	}
+
+	if err := f.Validate(); err != nil {
+		return File{}, fmt.Errorf("config %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Validate checks the values that are set, naming the offending field
+func (f File) Validate() error {
+	if f.Metrics.Interval != "" {
+		d, err := time.ParseDuration(f.Metrics.Interval)
+		if err != nil {
+			return fmt.Errorf("metrics.interval: %w", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("metrics.interval: must be positive, got %s", d)
+		}
+	}
+	if f.Metrics.WarmupDelay != "" {
+		if _, err := time.ParseDuration(f.Metrics.WarmupDelay); err != nil {
+			return fmt.Errorf("metrics.warmup_delay: %w", err)
+		}
+	}
+	if f.EBPF.MaxReloads != nil && *f.EBPF.MaxReloads < 0 {
+		return fmt.Errorf("ebpf.max_reloads: must not be negative, got %d", *f.EBPF.MaxReloads)
+	}
+	if f.Health.ReadyMinEntries != nil && *f.Health.ReadyMinEntries < 0 {
+		return fmt.Errorf("health.ready_min_entries: must not be negative, got %d", *f.Health.ReadyMinEntries)
+	}
+	if f.Health.RebuildThreshold != nil && *f.Health.RebuildThreshold < 0 {
+		return fmt.Errorf("health.rebuild_threshold: must not be negative, got %d", *f.Health.RebuildThreshold)
+	}
+	if f.Health.RebuildCooldown != "" {
+		if _, err := time.ParseDuration(f.Health.RebuildCooldown); err != nil {
+			return fmt.Errorf("health.rebuild_cooldown: %w", err)
+		}
+	}
+	return nil
+}
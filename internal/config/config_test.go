@@ -0,0 +1,73 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes content to a file named name in a temp dir and returns its path
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFormats(t *testing.T) {
+	yamlPath := writeConfig(t, "agent.yaml", `
+ebpf:
+  object: /opt/bpf/connect.o
+  kprobe_fallbacks: [tcp_v4_connect]
+metrics:
+  interval: 10s
+health:
+  ready_min_entries: 1
+`)
+	jsonPath := writeConfig(t, "agent.json", `{"ebpf": {"object": "/opt/bpf/connect.o", "kprobe_fallbacks": ["tcp_v4_connect"]}, "metrics": {"interval": "10s"}, "health": {"ready_min_entries": 1}}`)
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		f, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load(%s): %v", filepath.Base(path), err)
+		}
+		if f.EBPF.Object != "/opt/bpf/connect.o" || f.Metrics.Interval != "10s" || len(f.EBPF.KprobeFallbacks) != 1 {
+			t.Errorf("Load(%s) = %+v", filepath.Base(path), f)
+		}
+		if f.Health.ReadyMinEntries == nil || *f.Health.ReadyMinEntries != 1 {
+			t.Errorf("Load(%s): ready_min_entries = %v, want 1", filepath.Base(path), f.Health.ReadyMinEntries)
+		}
+		if f.Debug != nil {
+			t.Errorf("Load(%s): unset debug = %v, want nil", filepath.Base(path), *f.Debug)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"unknown yaml field", "agent.yaml", "metrics:\n  intervall: 5s\n", "intervall"},
+		{"unknown json field", "agent.json", `{"metrics": {"intervall": "5s"}}`, "intervall"},
+		{"unsupported extension", "agent.toml", "", "unsupported extension"},
+		{"bad interval", "agent.yaml", "metrics:\n  interval: soon\n", "metrics.interval"},
+		{"zero interval", "agent.yaml", "metrics:\n  interval: 0s\n", "must be positive"},
+		{"negative reloads", "agent.yaml", "ebpf:\n  max_reloads: -1\n", "ebpf.max_reloads"},
+		{"bad cooldown", "agent.json", `{"health": {"rebuild_cooldown": "later"}}`, "health.rebuild_cooldown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("Load accepted a missing file")
+	}
+}
@@ -0,0 +1,128 @@
+package procfs
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheSize is the default maximum number of cached process names
+const DefaultCacheSize = 4096
+
+// Cache is an LRU cache of process names keyed by PID. Names of processes
+// that can't be read are not cached, so exited PIDs are retried.
+type Cache struct {
+	mu      sync.Mutex
+	maxSize int
+	order   *list.List
+	items   map[int]*list.Element
+	hits    uint64
+	misses  uint64
+	lookup  func(pid int) string
+}
+
+type cacheEntry struct {
+	pid  int
+	name string
+}
+
+// CacheStats reports cache occupancy and hit/miss counts
+type CacheStats struct {
+	Size   int
+	Hits   uint64
+	Misses uint64
+}
+
+// HitRatio returns the fraction of lookups served from the cache
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// NewCache creates a name cache holding at most maxSize entries
+func NewCache(maxSize int) *Cache {
+	return NewCacheWithLookup(maxSize, GetProcessName)
+}
+
+// NewCacheWithLookup creates a name cache that resolves misses with lookup
+func NewCacheWithLookup(maxSize int, lookup func(pid int) string) *Cache {
+	if maxSize <= 0 {
+		maxSize = DefaultCacheSize
+	}
+	return &Cache{
+		maxSize: maxSize,
+		order:   list.New(),
+		items:   make(map[int]*list.Element),
+		lookup:  lookup,
+	}
+}
+
+// GetProcessName returns the cached process name for pid, reading it from /proc on a miss
+func (c *Cache) GetProcessName(pid int) string {
+	c.mu.Lock()
+	if el, ok := c.items[pid]; ok {
+		c.order.MoveToFront(el)
+		c.hits++
+		name := el.Value.(*cacheEntry).name
+		c.mu.Unlock()
+		return name
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	return c.Load(pid)
+}
+
+// Load reads the process name for pid from /proc and caches it. Unlike
+// GetProcessName it doesn't count a lookup, for callers that already
+// counted one with Peek.
+func (c *Cache) Load(pid int) string {
+	// Read outside the lock so a slow /proc doesn't serialize callers
+	name := c.lookup(pid)
+	if name == "unknown" {
+		return name
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[pid]; ok {
+		el.Value.(*cacheEntry).name = name
+		c.order.MoveToFront(el)
+		return name
+	}
+	c.items[pid] = c.order.PushFront(&cacheEntry{pid: pid, name: name})
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).pid)
+	}
+	return name
+}
+
+// Peek returns the cached name for pid without reading /proc on a miss.
+// Hits and misses are counted as for GetProcessName.
+func (c *Cache) Peek(pid int) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[pid]
+	if !ok {
+		c.misses++
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	c.hits++
+	return el.Value.(*cacheEntry).name, true
+}
+
+// Stats returns the current cache statistics
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Size:   c.order.Len(),
+		Hits:   c.hits,
+		Misses: c.misses,
+	}
+}
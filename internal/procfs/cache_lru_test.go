@@ -0,0 +1,35 @@
+package procfs
+
+import "testing"
+
+func TestCacheLRU(t *testing.T) {
+	lookup, reads := countingLookup()
+	c := NewCacheWithLookup(2, lookup)
+
+	c.GetProcessName(1)
+	c.GetProcessName(2)
+	c.GetProcessName(1) // 1 is now the most recently used
+	c.GetProcessName(3) // evicts 2
+	if *reads != 3 {
+		t.Fatalf("reads = %d, want 3", *reads)
+	}
+	if _, ok := c.Peek(2); ok {
+		t.Error("least recently used pid 2 was not evicted")
+	}
+	if name, ok := c.Peek(1); !ok || name != "proc-1" {
+		t.Errorf("Peek(1) = %q, %v, want proc-1", name, ok)
+	}
+	if got := c.Stats().Size; got != 2 {
+		t.Errorf("size = %d, want 2", got)
+	}
+}
+
+func TestCacheSkipsUnreadable(t *testing.T) {
+	lookup, reads := countingLookup()
+	c := NewCacheWithLookup(4, lookup)
+	c.GetProcessName(0)
+	c.GetProcessName(0)
+	if *reads != 2 {
+		t.Errorf("reads = %d, want an exited pid to be read again", *reads)
+	}
+}
@@ -0,0 +1,44 @@
+package procfs
+
+import (
+	"fmt"
+	"testing"
+)
+
+// countingLookup returns a lookup naming pids proc-<pid> and the number of
+// reads it served; pid 0 can't be read
+func countingLookup() (func(pid int) string, *int) {
+	reads := 0
+	return func(pid int) string {
+		reads++
+		if pid == 0 {
+			return "unknown"
+		}
+		return fmt.Sprintf("proc-%d", pid)
+	}, &reads
+}
+
+func TestCacheStats(t *testing.T) {
+	lookup, reads := countingLookup()
+	c := NewCacheWithLookup(4, lookup)
+
+	c.GetProcessName(1) // miss
+	c.GetProcessName(1) // hit
+	c.Peek(1)           // hit
+	c.Peek(2)           // miss
+	c.Load(2)           // fills the Peek miss without counting again
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("hits, misses = %d, %d, want 2, 2", stats.Hits, stats.Misses)
+	}
+	if got := stats.HitRatio(); got != 0.5 {
+		t.Errorf("hit ratio = %v, want 0.5", got)
+	}
+	if *reads != 2 {
+		t.Errorf("reads = %d, want 2", *reads)
+	}
+	if name, ok := c.Peek(2); !ok || name != "proc-2" {
+		t.Errorf("Load didn't cache pid 2: %q, %v", name, ok)
+	}
+}
@@ -0,0 +1,71 @@
+package procfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Pod identifies the Kubernetes pod and container a process runs in
+type Pod struct {
+	UID         string
+	ContainerID string
+}
+
+var (
+	// podUIDPattern matches the pod segment of both the cgroupfs
+	// (pod<uid>) and systemd (kubepods-<qos>-pod<uid_with_underscores>.slice) layouts
+	podUIDPattern = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+	// containerIDPattern matches a bare ID or a runtime scope such as
+	// cri-containerd-<id>.scope, docker-<id>.scope or crio-<id>.scope
+	containerIDPattern = regexp.MustCompile(`(?:^|-)([0-9a-f]{64})(?:\.scope)?$`)
+)
+
+// PodInfo returns the pod UID and container ID of pid from its cgroup path.
+// Processes outside a pod, such as host daemons, yield an empty Pod.
+func PodInfo(pid int) (Pod, error) {
+	data, err := os.ReadFile(filepath.Join(root, fmt.Sprint(pid), "cgroup"))
+	if err != nil {
+		return Pod{}, err
+	}
+	return parsePodInfo(string(data)), nil
+}
+
+// parsePodInfo extracts the pod from /proc/<pid>/cgroup contents. Lines are
+// hierarchy-ID:controllers:path, a single 0::path line on cgroup v2 and one
+// per controller on v1; the first path inside a pod wins.
+func parsePodInfo(cgroup string) Pod {
+	for _, line := range strings.Split(cgroup, "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if pod, ok := podFromPath(fields[2]); ok {
+			return pod
+		}
+	}
+	return Pod{}
+}
+
+// podFromPath returns the pod of a cgroup path, and false if it isn't in one
+func podFromPath(path string) (Pod, bool) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		m := podUIDPattern.FindStringSubmatch(segment)
+		if m == nil {
+			continue
+		}
+
+		pod := Pod{UID: strings.ReplaceAll(m[1], "_", "-")}
+		// The container is the innermost segment below the pod, if any
+		if last := segments[len(segments)-1]; i < len(segments)-1 {
+			if c := containerIDPattern.FindStringSubmatch(last); c != nil {
+				pod.ContainerID = c[1]
+			}
+		}
+		return pod, true
+	}
+	return Pod{}, false
+}
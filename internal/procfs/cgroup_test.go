@@ -0,0 +1,65 @@
+package procfs
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePodInfo(t *testing.T) {
+	const (
+		uid = "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0"
+		cid = "3c1f0ef1d1e2853d3bde8e7c6d0a68c7495e5ef56ac1c9c6b54a0c2bf6a2f0d1"
+	)
+	tests := []struct {
+		name   string
+		cgroup string
+		want   Pod
+	}{
+		{
+			name:   "cgroupfs v2",
+			cgroup: "0::/kubepods/burstable/pod" + uid + "/" + cid + "\n",
+			want:   Pod{UID: uid, ContainerID: cid},
+		},
+		{
+			name:   "systemd v2",
+			cgroup: "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + strings.ReplaceAll(uid, "-", "_") + ".slice/cri-containerd-" + cid + ".scope\n",
+			want:   Pod{UID: uid, ContainerID: cid},
+		},
+		{
+			name:   "v1 first pod path wins",
+			cgroup: "12:cpuset:/\n11:memory:/kubepods/pod" + uid + "/docker-" + cid + ".scope\n",
+			want:   Pod{UID: uid, ContainerID: cid},
+		},
+		{
+			name:   "pod without container",
+			cgroup: "0::/kubepods/besteffort/pod" + uid + "\n",
+			want:   Pod{UID: uid},
+		},
+		{
+			name:   "host process",
+			cgroup: "0::/system.slice/sshd.service\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsePodInfo(tt.cgroup); got != tt.want {
+				t.Fatalf("parsePodInfo = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodInfo(t *testing.T) {
+	proc := t.TempDir()
+	useRoot(t, proc)
+	writeFile(t, filepath.Join(proc, "7", "cgroup"), "0::/kubepods/pod0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0\n")
+
+	pod, err := PodInfo(7)
+	if err != nil || pod.UID != "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0" {
+		t.Fatalf("PodInfo(7) = %+v, %v", pod, err)
+	}
+	if _, err := PodInfo(8); err == nil {
+		t.Fatal("PodInfo of a missing pid returned no error")
+	}
+}
@@ -0,0 +1,78 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NameSource identifies where a process name is read from
+type NameSource string
+
+const (
+	// NameFromComm reads /proc/<pid>/comm
+	NameFromComm NameSource = "comm"
+	// NameFromCmdline uses the basename of argv[0] in /proc/<pid>/cmdline
+	NameFromCmdline NameSource = "cmdline"
+	// NameFromExe uses the basename of the /proc/<pid>/exe link target
+	NameFromExe NameSource = "exe"
+)
+
+// DefaultNameSources is the fallback order used when none is configured
+var DefaultNameSources = []NameSource{NameFromComm, NameFromCmdline, NameFromExe}
+
+// ReadName reads the process name for pid from a single source
+func ReadName(pid int, source NameSource) (string, error) {
+	dir := filepath.Join(root, fmt.Sprint(pid))
+	switch source {
+	case NameFromComm:
+		data, err := os.ReadFile(filepath.Join(dir, "comm"))
+		if err != nil {
+			return "", err
+		}
+		return nonEmpty(strings.TrimSpace(string(data)), source)
+	case NameFromCmdline:
+		data, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil {
+			return "", err
+		}
+		argv0, _, _ := bytes.Cut(data, []byte{0})
+		return nonEmpty(filepath.Base(string(argv0)), source)
+	case NameFromExe:
+		target, err := os.Readlink(filepath.Join(dir, "exe"))
+		if err != nil {
+			return "", err
+		}
+		target = strings.TrimSuffix(target, " (deleted)")
+		return nonEmpty(filepath.Base(target), source)
+	default:
+		return "", fmt.Errorf("unknown name source %q", source)
+	}
+}
+
+// nonEmpty rejects names that carry no information, such as the empty
+// cmdline of kernel threads
+func nonEmpty(name string, source NameSource) (string, error) {
+	if name == "" || name == "." || name == "/" {
+		return "", fmt.Errorf("empty %s", source)
+	}
+	return name, nil
+}
+
+// NewNameResolver returns a lookup that tries each source in order and
+// falls back to "unknown" when all of them fail
+func NewNameResolver(sources []NameSource) func(pid int) string {
+	if len(sources) == 0 {
+		sources = DefaultNameSources
+	}
+	return func(pid int) string {
+		for _, source := range sources {
+			if name, err := ReadName(pid, source); err == nil {
+				return name
+			}
+		}
+		return "unknown"
+	}
+}
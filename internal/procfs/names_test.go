@@ -0,0 +1,53 @@
+package procfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useRoot points lookups at r for the duration of the test
+func useRoot(t *testing.T, r string) {
+	t.Helper()
+	orig := Root()
+	SetRoot(r)
+	t.Cleanup(func() { SetRoot(orig) })
+}
+
+func TestNameResolverFallbacks(t *testing.T) {
+	proc := t.TempDir()
+	useRoot(t, proc)
+	writeFile(t, filepath.Join(proc, "1", "comm"), "systemd\n")
+	writeFile(t, filepath.Join(proc, "2", "comm"), "\n")
+	writeFile(t, filepath.Join(proc, "2", "cmdline"), "/usr/sbin/nginx\x00-g\x00daemon off;")
+	writeFile(t, filepath.Join(proc, "3", "cmdline"), "")
+	if err := os.Symlink("/usr/sbin/sshd (deleted)", filepath.Join(proc, "3", "exe")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(proc, "4"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	resolve := NewNameResolver(nil)
+	for pid, want := range map[int]string{1: "systemd", 2: "nginx", 3: "sshd", 4: "unknown"} {
+		if got := resolve(pid); got != want {
+			t.Errorf("pid %d: got %q, want %q", pid, got, want)
+		}
+	}
+
+	// Only the configured sources are consulted, in order
+	exeFirst := NewNameResolver([]NameSource{NameFromExe, NameFromComm})
+	if got := exeFirst(1); got != "systemd" {
+		t.Errorf("exe then comm for pid 1: got %q, want systemd", got)
+	}
+	commOnly := NewNameResolver([]NameSource{NameFromComm})
+	if got := commOnly(2); got != "unknown" {
+		t.Errorf("comm only for pid 2: got %q, want unknown", got)
+	}
+}
+
+func TestReadNameUnknownSource(t *testing.T) {
+	if _, err := ReadName(1, "environ"); err == nil {
+		t.Fatal("ReadName accepted an unknown source")
+	}
+}
@@ -3,14 +3,136 @@ package procfs
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// DefaultRoot is the default mount point of the proc filesystem
+const DefaultRoot = "/proc"
+
+// root is the proc filesystem used for lookups
+var root = DefaultRoot
+
+// SetRoot changes the proc filesystem root, e.g. to /host/proc when running
+// as a node agent. It must be called before any lookups are made.
+func SetRoot(r string) {
+	root = r
+}
+
+// Root returns the proc filesystem root used for lookups
+func Root() string {
+	return root
+}
+
 // GetProcessName returns the process name (comm) for a given PID
 func GetProcessName(pid int) string {
-	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	data, err := os.ReadFile(filepath.Join(root, fmt.Sprint(pid), "comm"))
 	if err != nil {
 		return "unknown"
 	}
 	return strings.TrimSpace(string(data))
 }
+
+// ValidateRoot checks that r looks like a mounted proc filesystem by reading self/comm
+func ValidateRoot(r string) error {
+	info, err := os.Stat(r)
+	if err != nil {
+		return fmt.Errorf("proc root %q: %w", r, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("proc root %q is not a directory", r)
+	}
+
+	comm := filepath.Join(r, "self", "comm")
+	data, err := os.ReadFile(comm)
+	if err != nil {
+		return fmt.Errorf("proc root %q does not look like procfs (is it mounted?): %w", r, err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return fmt.Errorf("proc root %q does not look like procfs: %s is empty", r, comm)
+	}
+	return nil
+}
+
+// WaitForRoot retries ValidateRoot up to attempts times, sleeping delay between
+// tries, to tolerate mounts that appear shortly after startup
+func WaitForRoot(r string, attempts int, delay time.Duration) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = ValidateRoot(r); err == nil {
+			return nil
+		}
+		if i < attempts-1 {
+			time.Sleep(delay)
+		}
+	}
+	return fmt.Errorf("after %d attempts: %w", attempts, err)
+}
+
+// GetTGID returns the thread group ID (the owning process) for a given PID
+func GetTGID(pid int) (int, error) {
+	data, err := os.ReadFile(filepath.Join(root, fmt.Sprint(pid), "status"))
+	if err != nil {
+		return 0, err
+	}
+	return parseTGID(string(data))
+}
+
+// parseTGID extracts the Tgid field from /proc/<pid>/status contents
+func parseTGID(status string) (int, error) {
+	for _, line := range strings.Split(status, "\n") {
+		value, ok := strings.CutPrefix(line, "Tgid:")
+		if !ok {
+			continue
+		}
+		tgid, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return 0, fmt.Errorf("parse Tgid %q: %w", value, err)
+		}
+		return tgid, nil
+	}
+	return 0, fmt.Errorf("no Tgid line in status")
+}
+
+// OpenFDs returns the number of file descriptors open in this process,
+// counted from self/fd. Every eBPF map, program and link holds one, so a
+// growing count points at a leak.
+func OpenFDs() (int, error) {
+	return countFDs(filepath.Join(root, "self", "fd"))
+}
+
+// countFDs counts the entries of an fd directory
+func countFDs(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// BootTime returns the system boot time from the btime line of /proc/stat
+func BootTime() (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(root, "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseBootTime(string(data))
+}
+
+// parseBootTime extracts btime from /proc/stat contents
+func parseBootTime(stat string) (time.Time, error) {
+	for _, line := range strings.Split(stat, "\n") {
+		value, ok := strings.CutPrefix(line, "btime ")
+		if !ok {
+			continue
+		}
+		secs, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parse btime %q: %w", value, err)
+		}
+		return time.Unix(secs, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("no btime line in stat")
+}
@@ -0,0 +1,111 @@
+package procfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile creates path with content, making parent directories
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateRoot(t *testing.T) {
+	proc := t.TempDir()
+	writeFile(t, filepath.Join(proc, "self", "comm"), "agent\n")
+	empty := t.TempDir()
+	writeFile(t, filepath.Join(empty, "self", "comm"), "")
+	file := filepath.Join(t.TempDir(), "proc")
+	writeFile(t, file, "")
+
+	tests := []struct {
+		name string
+		root string
+		want string
+	}{
+		{"procfs", proc, ""},
+		{"missing", filepath.Join(proc, "missing"), "no such file"},
+		{"file", file, "is not a directory"},
+		{"not mounted", t.TempDir(), "is it mounted?"},
+		{"empty comm", empty, "is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRoot(tt.root)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("ValidateRoot: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ValidateRoot = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitForRoot(t *testing.T) {
+	proc := t.TempDir()
+	err := WaitForRoot(proc, 3, time.Millisecond)
+	if err == nil || !strings.HasPrefix(err.Error(), "after 3 attempts: ") {
+		t.Fatalf("WaitForRoot on an empty dir = %v, want the attempt count", err)
+	}
+
+	// A mount appearing between attempts is picked up
+	if err := os.Mkdir(filepath.Join(proc, "self"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = os.WriteFile(filepath.Join(proc, "self", "comm"), []byte("agent\n"), 0o644)
+	}()
+	if err := WaitForRoot(proc, 100, 5*time.Millisecond); err != nil {
+		t.Fatalf("WaitForRoot after the mount appeared: %v", err)
+	}
+}
+
+func TestParseTGID(t *testing.T) {
+	tgid, err := parseTGID("Name:\tworker\nUmask:\t0022\nState:\tS (sleeping)\nTgid:\t1234\nPid:\t1240\n")
+	if err != nil || tgid != 1234 {
+		t.Fatalf("parseTGID = %d, %v, want 1234", tgid, err)
+	}
+	if _, err := parseTGID("Name:\tworker\n"); err == nil {
+		t.Fatal("parseTGID accepted status without a Tgid line")
+	}
+	if _, err := parseTGID("Tgid:\tabc\n"); err == nil {
+		t.Fatal("parseTGID accepted a non-numeric Tgid")
+	}
+}
+
+func TestParseBootTime(t *testing.T) {
+	boot, err := parseBootTime("cpu  1 2 3 4\nintr 5\nbtime 1700000000\nprocesses 10\n")
+	if err != nil || !boot.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("parseBootTime = %v, %v, want 1700000000", boot, err)
+	}
+	if _, err := parseBootTime("cpu  1 2 3 4\n"); err == nil {
+		t.Fatal("parseBootTime accepted stat without a btime line")
+	}
+}
+
+func TestCountFDs(t *testing.T) {
+	dir := t.TempDir()
+	for _, fd := range []string{"0", "1", "2", "5"} {
+		writeFile(t, filepath.Join(dir, fd), "")
+	}
+	if n, err := countFDs(dir); err != nil || n != 4 {
+		t.Fatalf("countFDs = %d, %v, want 4", n, err)
+	}
+	if n, err := OpenFDs(); err != nil || n == 0 {
+		t.Fatalf("OpenFDs = %d, %v, want this process's descriptors", n, err)
+	}
+}
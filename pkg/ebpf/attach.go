@@ -0,0 +1,137 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// AttachType selects how the program is attached to the kernel
+type AttachType int
+
+const (
+	// AttachKprobe attaches the program as a kprobe on KprobeSymbol
+	AttachKprobe AttachType = iota
+	// AttachFentry attaches a tracing program to the entry of KprobeSymbol via a BPF trampoline
+	AttachFentry
+	// AttachFexit attaches a tracing program to the exit of KprobeSymbol via a BPF trampoline
+	AttachFexit
+	// AttachPerfEvent attaches a perf event program to the event described by Config.PerfEvent
+	AttachPerfEvent
+)
+
+// String returns the name of the attach type
+func (t AttachType) String() string {
+	switch t {
+	case AttachKprobe:
+		return "kprobe"
+	case AttachFentry:
+		return "fentry"
+	case AttachFexit:
+		return "fexit"
+	case AttachPerfEvent:
+		return "perf_event"
+	default:
+		return fmt.Sprintf("AttachType(%d)", int(t))
+	}
+}
+
+// Attach functions, replaceable in tests
+var (
+	attachKprobe  = link.Kprobe
+	attachTracing = link.AttachTracing
+)
+
+// prepareProgramSpec configures the program spec for the attach type before
+// the collection is created; tracing programs bind their target at load time
+func prepareProgramSpec(cfg Config, spec *ebpf.CollectionSpec) error {
+	if cfg.AttachType != AttachFentry && cfg.AttachType != AttachFexit {
+		return nil
+	}
+
+	ps := spec.Programs[cfg.ProgramName]
+	if ps == nil {
+		return fmt.Errorf("program %q not found", cfg.ProgramName)
+	}
+	if ps.Type != ebpf.Tracing {
+		return fmt.Errorf("program %q is of type %s, %s requires a tracing program", cfg.ProgramName, ps.Type, cfg.AttachType)
+	}
+
+	ps.AttachTo = cfg.KprobeSymbol
+	ps.AttachType = ebpf.AttachTraceFEntry
+	if cfg.AttachType == AttachFexit {
+		ps.AttachType = ebpf.AttachTraceFExit
+	}
+	return nil
+}
+
+// attachment is the set of links, and any resources backing them, created by one attach
+type attachment struct {
+	links   []link.Link
+	closers []io.Closer
+
+	// createdPin is set when the link was pinned by this attach rather than adopted
+	createdPin bool
+}
+
+// close detaches all links and releases their backing resources
+func (a *attachment) close() error {
+	var err error
+	for _, l := range a.links {
+		if e := l.Close(); e != nil {
+			err = e
+		}
+	}
+	for _, c := range a.closers {
+		if e := c.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// attachProgram attaches prog according to cfg.AttachType. On reload a
+// pinned kprobe link is replaced rather than adopted.
+func attachProgram(cfg Config, prog *ebpf.Program, reload bool) (*attachment, error) {
+	if len(cfg.CPUMask) > 0 && cfg.AttachType != AttachPerfEvent {
+		return nil, fmt.Errorf("CPUMask is only supported with %s attachment", AttachPerfEvent)
+	}
+	if cfg.LinkPinPath != "" && cfg.AttachType != AttachKprobe {
+		return nil, fmt.Errorf("LinkPinPath is only supported with %s attachment", AttachKprobe)
+	}
+
+	switch cfg.AttachType {
+	case AttachKprobe:
+		if cfg.LinkPinPath != "" {
+			return attachPinnedKprobe(cfg, prog, reload)
+		}
+		l, err := attachKprobeSymbols(cfg.KprobeSymbol, cfg.FallbackKprobeSymbols, prog)
+		if err != nil {
+			return nil, fmt.Errorf("link kprobe: %w", err)
+		}
+		return &attachment{links: []link.Link{l}}, nil
+
+	case AttachPerfEvent:
+		return attachPerfEvent(cfg.PerfEvent, cfg.CPUMask, prog)
+
+	case AttachFentry, AttachFexit:
+		attachType := ebpf.AttachTraceFEntry
+		if cfg.AttachType == AttachFexit {
+			attachType = ebpf.AttachTraceFExit
+		}
+		l, err := attachTracing(link.TracingOptions{Program: prog, AttachType: attachType})
+		if errors.Is(err, ebpf.ErrNotSupported) {
+			return nil, fmt.Errorf("link %s: kernel lacks BPF trampoline support: %w", cfg.AttachType, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("link %s: %w", cfg.AttachType, err)
+		}
+		return &attachment{links: []link.Link{l}}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported attach type %s", cfg.AttachType)
+	}
+}
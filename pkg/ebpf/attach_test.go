@@ -0,0 +1,77 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+func TestPrepareProgramSpec(t *testing.T) {
+	tests := []struct {
+		name       string
+		attach     AttachType
+		progType   ebpf.ProgramType
+		wantAttach ebpf.AttachType
+		wantErr    bool
+	}{
+		{name: "kprobe untouched", attach: AttachKprobe, progType: ebpf.Kprobe},
+		{name: "fentry", attach: AttachFentry, progType: ebpf.Tracing, wantAttach: ebpf.AttachTraceFEntry},
+		{name: "fexit", attach: AttachFexit, progType: ebpf.Tracing, wantAttach: ebpf.AttachTraceFExit},
+		{name: "fentry needs tracing program", attach: AttachFentry, progType: ebpf.Kprobe, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{ProgramName: "trace_connect", KprobeSymbol: "tcp_connect", AttachType: tt.attach}
+			spec := &ebpf.CollectionSpec{Programs: map[string]*ebpf.ProgramSpec{"trace_connect": {Type: tt.progType}}}
+			err := prepareProgramSpec(cfg, spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("prepareProgramSpec returned no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("prepareProgramSpec: %v", err)
+			}
+			ps := spec.Programs["trace_connect"]
+			if ps.AttachType != tt.wantAttach {
+				t.Errorf("AttachType = %s, want %s", ps.AttachType, tt.wantAttach)
+			}
+			if tt.wantAttach != 0 && ps.AttachTo != "tcp_connect" {
+				t.Errorf("AttachTo = %q, want tcp_connect", ps.AttachTo)
+			}
+		})
+	}
+
+	cfg := Config{ProgramName: "missing", AttachType: AttachFexit}
+	if err := prepareProgramSpec(cfg, &ebpf.CollectionSpec{}); err == nil {
+		t.Error("prepareProgramSpec succeeded for a missing program")
+	}
+}
+
+func TestAttachProgramTracing(t *testing.T) {
+	orig := attachTracing
+	t.Cleanup(func() { attachTracing = orig })
+
+	var got link.TracingOptions
+	attachTracing = func(opts link.TracingOptions) (link.Link, error) {
+		got = opts
+		return nil, fmt.Errorf("attach: %w", ebpf.ErrNotSupported)
+	}
+
+	_, err := attachProgram(Config{AttachType: AttachFexit}, nil, false)
+	if !errors.Is(err, ebpf.ErrNotSupported) || !strings.Contains(err.Error(), "trampoline") {
+		t.Fatalf("attachProgram error = %v, want an unsupported trampoline error", err)
+	}
+	if got.AttachType != ebpf.AttachTraceFExit {
+		t.Errorf("attached as %s, want fexit", got.AttachType)
+	}
+
+	if _, err := attachProgram(Config{AttachType: AttachType(7)}, nil, false); err == nil || !strings.Contains(err.Error(), "AttachType(7)") {
+		t.Errorf("unknown attach type error = %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package ebpf
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// selfStatusPath is where the agent's own capabilities are read from
+const selfStatusPath = "/proc/self/status"
+
+// Capabilities reports the effective capabilities relevant to loading eBPF
+type Capabilities struct {
+	Effective string `json:"effective"`
+	BPF       bool   `json:"cap_bpf"`
+	PerfMon   bool   `json:"cap_perfmon"`
+	SysAdmin  bool   `json:"cap_sys_admin"`
+}
+
+// CanLoad reports whether the capabilities are likely sufficient to load
+// and attach tracing programs: CAP_SYS_ADMIN, or CAP_BPF with CAP_PERFMON
+func (c Capabilities) CanLoad() bool {
+	return c.SysAdmin || (c.BPF && c.PerfMon)
+}
+
+// String formats the capabilities as a single key=value line for logging
+func (c Capabilities) String() string {
+	return fmt.Sprintf("cap_eff=%s cap_bpf=%t cap_perfmon=%t cap_sys_admin=%t",
+		c.Effective, c.BPF, c.PerfMon, c.SysAdmin)
+}
+
+// ReadCapabilities returns the effective capabilities of the current process
+func ReadCapabilities() (Capabilities, error) {
+	data, err := os.ReadFile(selfStatusPath)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	return parseCapabilities(string(data))
+}
+
+// parseCapabilities extracts the CapEff bitmask from /proc/<pid>/status contents
+func parseCapabilities(status string) (Capabilities, error) {
+	for _, line := range strings.Split(status, "\n") {
+		value, ok := strings.CutPrefix(line, "CapEff:")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		bits, err := strconv.ParseUint(value, 16, 64)
+		if err != nil {
+			return Capabilities{}, fmt.Errorf("parse CapEff %q: %w", value, err)
+		}
+		has := func(capability uint) bool { return bits&(1<<capability) != 0 }
+		return Capabilities{
+			Effective: value,
+			BPF:       has(unix.CAP_BPF),
+			PerfMon:   has(unix.CAP_PERFMON),
+			SysAdmin:  has(unix.CAP_SYS_ADMIN),
+		}, nil
+	}
+	return Capabilities{}, fmt.Errorf("no CapEff line in status")
+}
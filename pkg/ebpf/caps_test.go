@@ -0,0 +1,38 @@
+package ebpf
+
+import "testing"
+
+func TestParseCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		capEff  string
+		want    Capabilities
+		canLoad bool
+	}{
+		{"root", "000001ffffffffff", Capabilities{Effective: "000001ffffffffff", BPF: true, PerfMon: true, SysAdmin: true}, true},
+		{"bpf and perfmon", "000000c000000000", Capabilities{Effective: "000000c000000000", BPF: true, PerfMon: true}, true},
+		{"bpf only", "0000008000000000", Capabilities{Effective: "0000008000000000", BPF: true}, false},
+		{"sys_admin only", "0000000000200000", Capabilities{Effective: "0000000000200000", SysAdmin: true}, true},
+		{"none", "0000000000000000", Capabilities{Effective: "0000000000000000"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCapabilities("Name:\tagent\nCapInh:\t0000000000000000\nCapEff:\t" + tt.capEff + "\nCapBnd:\t000001ffffffffff\n")
+			if err != nil {
+				t.Fatalf("parseCapabilities: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if got.CanLoad() != tt.canLoad {
+				t.Errorf("CanLoad() = %v, want %v", got.CanLoad(), tt.canLoad)
+			}
+		})
+	}
+
+	for _, bad := range []string{"Name:\tagent\n", "CapEff:\tzz\n"} {
+		if _, err := parseCapabilities(bad); err == nil {
+			t.Errorf("parseCapabilities(%q) returned no error", bad)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package ebpf
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+// applyConstants sets the named const volatile globals of the spec before
+// the collection is created, so the verifier sees the final values
+func applyConstants(spec *ebpf.CollectionSpec, constants map[string]interface{}) error {
+	for name, value := range constants {
+		v := spec.Variables[name]
+		if v == nil {
+			return fmt.Errorf("constant %q not found in object", name)
+		}
+		if !v.Constant() {
+			return fmt.Errorf("variable %q is not a const volatile", name)
+		}
+		if err := v.Set(value); err != nil {
+			return fmt.Errorf("set constant %q: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package ebpf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+// variablesObject is the variables test object of github.com/cilium/ebpf,
+// holding the const volatile var_rodata and the writable var_data
+const variablesObject = "testdata/variables-el.elf"
+
+func TestApplyConstants(t *testing.T) {
+	spec, err := ebpf.LoadCollectionSpec(variablesObject)
+	if err != nil {
+		t.Fatalf("load spec: %v", err)
+	}
+	if err := applyConstants(spec, nil); err != nil {
+		t.Fatalf("no constants: %v", err)
+	}
+
+	if err := applyConstants(spec, map[string]interface{}{"var_rodata": uint32(42)}); err != nil {
+		t.Fatalf("applyConstants: %v", err)
+	}
+	var got uint32
+	if err := spec.Variables["var_rodata"].Get(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != 42 {
+		t.Errorf("var_rodata = %d after applyConstants, want 42", got)
+	}
+
+	for _, tt := range []struct {
+		constants map[string]interface{}
+		wantErr   string
+	}{
+		{map[string]interface{}{"target_pid": uint32(42)}, `"target_pid" not found`},
+		{map[string]interface{}{"var_data": uint32(1)}, `"var_data" is not a const volatile`},
+		{map[string]interface{}{"var_rodata": uint64(1)}, `set constant "var_rodata"`},
+	} {
+		err := applyConstants(spec, tt.constants)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("applyConstants(%v) = %v, want an error containing %q", tt.constants, err, tt.wantErr)
+		}
+	}
+}
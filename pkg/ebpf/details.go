@@ -0,0 +1,111 @@
+package ebpf
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+// Details is a diagnostic view of the loaded program, its attachment and map
+type Details struct {
+	Program      string `json:"program"`
+	AttachType   string `json:"attach_type"`
+	AttachTarget string `json:"attach_target"`
+	Attached     bool   `json:"attached"`
+	MapName      string `json:"map_name"`
+	MapType      string `json:"map_type"`
+	MapEntries   int    `json:"map_entries"`
+}
+
+// MapInfo is a stable description of a loaded map
+type MapInfo struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	KeySize    uint32 `json:"key_size"`
+	ValueSize  uint32 `json:"value_size"`
+	MaxEntries uint32 `json:"max_entries"`
+	Entries    int    `json:"entries"`
+	ID         uint32 `json:"id"`
+}
+
+// MapInfo describes the named map from the loaded collection, including its current entry count
+func (m *Manager) MapInfo(name string) (MapInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.state == nil {
+		return MapInfo{}, fmt.Errorf("manager is closed")
+	}
+	bpfMap := m.state.collection.Maps[name]
+	if bpfMap == nil {
+		return MapInfo{}, fmt.Errorf("map %q not found", name)
+	}
+	return describeMap(name, bpfMap)
+}
+
+// describeMap builds a MapInfo from a map handle
+func describeMap(name string, bpfMap *ebpf.Map) (MapInfo, error) {
+	mi := MapInfo{
+		Name:       name,
+		Type:       bpfMap.Type().String(),
+		KeySize:    bpfMap.KeySize(),
+		ValueSize:  bpfMap.ValueSize(),
+		MaxEntries: bpfMap.MaxEntries(),
+	}
+
+	info, err := bpfMap.Info()
+	if err != nil {
+		return mi, fmt.Errorf("map info: %w", err)
+	}
+	if id, ok := info.ID(); ok {
+		mi.ID = uint32(id)
+	}
+
+	mi.Entries, err = countEntries(bpfMap)
+	if err != nil {
+		return mi, fmt.Errorf("count map entries: %w", err)
+	}
+	return mi, nil
+}
+
+// Details reports the current state of the eBPF subsystem
+func (m *Manager) Details() (Details, error) {
+	m.mu.Lock()
+	state := m.state
+	m.mu.Unlock()
+	attached := state != nil && state.attached()
+
+	d := Details{
+		Program:      m.cfg.ProgramName,
+		AttachType:   m.cfg.AttachType.String(),
+		AttachTarget: m.cfg.KprobeSymbol,
+		Attached:     attached,
+		MapName:      m.cfg.MapName,
+	}
+	if !attached {
+		return d, nil
+	}
+
+	info, err := m.MapInfo(m.cfg.MapName)
+	d.MapType = info.Type
+	d.MapEntries = info.Entries
+	return d, err
+}
+
+// countEntries counts the keys in a map without reading values
+func countEntries(m *ebpf.Map) (int, error) {
+	// A nil interface key starts iteration from the first key
+	var key interface{}
+	n := 0
+	for {
+		next, err := m.NextKeyBytes(key)
+		if err != nil {
+			return n, err
+		}
+		if next == nil {
+			return n, nil
+		}
+		n++
+		key = next
+	}
+}
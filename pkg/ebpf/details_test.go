@@ -0,0 +1,67 @@
+package ebpf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+func TestManagerMapInfo(t *testing.T) {
+	counts := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: 8, MaxEntries: 16})
+	for _, k := range []uint32{1, 2} {
+		if err := counts.Put(k, uint64(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &Manager{state: &loaded{collection: &ebpf.Collection{Maps: map[string]*ebpf.Map{"counts": counts}}}}
+
+	got, err := m.MapInfo("counts")
+	if err != nil {
+		t.Fatalf("MapInfo: %v", err)
+	}
+	want := MapInfo{Name: "counts", Type: "Hash", KeySize: 4, ValueSize: 8, MaxEntries: 16, Entries: 2, ID: got.ID}
+	if got != want {
+		t.Errorf("MapInfo = %+v, want %+v", got, want)
+	}
+	if got.ID == 0 {
+		t.Error("MapInfo has no map ID")
+	}
+
+	if _, err := m.MapInfo("missing"); err == nil {
+		t.Error("MapInfo succeeded for a missing map")
+	}
+	if _, err := (&Manager{}).MapInfo("counts"); err == nil {
+		t.Error("MapInfo succeeded on a closed manager")
+	}
+}
+
+func TestDetailsAttached(t *testing.T) {
+	counts := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: 8, MaxEntries: 16})
+	coll := &ebpf.Collection{Maps: map[string]*ebpf.Map{"counts": counts}}
+
+	for _, tt := range []struct {
+		name  string
+		links []link.Link
+		want  bool
+	}{
+		{"attached", []link.Link{fakeLink{}}, true},
+		{"detached from outside", []link.Link{fakeLink{err: errors.New("bad file descriptor")}}, false},
+		{"no links", nil, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{
+				cfg:   Config{MapName: "counts"},
+				state: &loaded{collection: coll, attachment: &attachment{links: tt.links}},
+			}
+			d, err := m.Details()
+			if err != nil {
+				t.Fatalf("Details: %v", err)
+			}
+			if d.Attached != tt.want {
+				t.Errorf("Attached = %v, want %v", d.Attached, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package ebpf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+// validateExpected checks the spec holds exactly the expected programs and
+// maps. Global data section maps such as .rodata are ignored. An empty
+// expectation skips the corresponding check.
+func validateExpected(spec *ebpf.CollectionSpec, programs, maps []string) error {
+	if len(programs) > 0 {
+		if err := compareNames("programs", keys(spec.Programs), programs); err != nil {
+			return err
+		}
+	}
+	if len(maps) > 0 {
+		userMaps := slices.DeleteFunc(keys(spec.Maps), func(name string) bool {
+			return strings.HasPrefix(name, ".")
+		})
+		if err := compareNames("maps", userMaps, maps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareNames reports the names missing from got and the unexpected extras
+func compareNames(kind string, got, want []string) error {
+	var missing, extra []string
+	for _, name := range want {
+		if !slices.Contains(got, name) {
+			missing = append(missing, name)
+		}
+	}
+	for _, name := range got {
+		if !slices.Contains(want, name) {
+			extra = append(extra, name)
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		problems = append(problems, "unexpected "+strings.Join(extra, ", "))
+	}
+	return fmt.Errorf("object %s differ from expected: %s", kind, strings.Join(problems, "; "))
+}
+
+// keys returns the sorted keys of m
+func keys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	slices.Sort(out)
+	return out
+}
@@ -0,0 +1,42 @@
+package ebpf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+func TestValidateExpected(t *testing.T) {
+	spec := &ebpf.CollectionSpec{
+		Programs: map[string]*ebpf.ProgramSpec{"trace_connect": {}, "trace_exit": {}},
+		Maps:     map[string]*ebpf.MapSpec{"counts": {}, ".rodata": {}},
+	}
+	tests := []struct {
+		name     string
+		programs []string
+		maps     []string
+		wantErr  string
+	}{
+		{"no expectation", nil, nil, ""},
+		{"exact match", []string{"trace_exit", "trace_connect"}, []string{"counts"}, ""},
+		{"missing program", []string{"trace_connect", "trace_exit", "trace_open"}, nil, "missing trace_open"},
+		{"unexpected program", []string{"trace_connect"}, nil, "unexpected trace_exit"},
+		{"both", []string{"trace_connect", "trace_open"}, nil, "missing trace_open; unexpected trace_exit"},
+		{"missing map", nil, []string{"counts", "events"}, "object maps differ from expected: missing events"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateExpected(spec, tt.programs, tt.maps)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
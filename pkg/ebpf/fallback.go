@@ -0,0 +1,71 @@
+package ebpf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
+)
+
+// kallsymsPath lists the kernel symbols, replaceable in tests
+var kallsymsPath = "/proc/kallsyms"
+
+// attachKprobeSymbols attaches a kprobe on primary, trying each fallback in
+// order while the symbol is missing. Any other failure, such as a
+// permission error, is returned without trying the fallbacks. When every
+// fallback is missing too, the primary's error is returned.
+func attachKprobeSymbols(primary string, fallbacks []string, prog *ebpf.Program) (link.Link, error) {
+	l, err := attachKprobe(primary, prog, nil)
+	if err == nil || len(fallbacks) == 0 || !isSymbolNotFound(err, primary) {
+		return l, err
+	}
+
+	for _, symbol := range fallbacks {
+		l, fallbackErr := attachKprobe(symbol, prog, nil)
+		if fallbackErr == nil {
+			log.Printf("kprobe symbol %s not found, attached to fallback %s", primary, symbol)
+			return l, nil
+		}
+		if !isSymbolNotFound(fallbackErr, symbol) {
+			return nil, fmt.Errorf("fallback %s: %w", symbol, fallbackErr)
+		}
+	}
+	return nil, fmt.Errorf("%w (fallbacks %v not found either)", err, fallbacks)
+}
+
+// isSymbolNotFound reports whether a kprobe on symbol failed because the
+// symbol is missing. Older kernels reject a missing symbol written to
+// tracefs with EINVAL rather than ENOENT, but EINVAL also covers bad
+// programs or flags, so it only counts when kallsyms lacks the symbol.
+func isSymbolNotFound(err error, symbol string) bool {
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	return errors.Is(err, unix.EINVAL) && !hasKernelSymbol(symbol)
+}
+
+// hasKernelSymbol reports whether kallsyms lists symbol. If kallsyms can't
+// be read the symbol is assumed to exist, so the original error is kept.
+func hasKernelSymbol(symbol string) bool {
+	f, err := os.Open(kallsymsPath)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+
+	// Lines are "address type name [module]"
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && fields[2] == symbol {
+			return true
+		}
+	}
+	return scanner.Err() != nil
+}
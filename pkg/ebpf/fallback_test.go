@@ -0,0 +1,104 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
+)
+
+// fakeKprobes replaces attachKprobe with one failing with errs by symbol,
+// recording the symbols tried, and kallsyms with a file listing symbols
+func fakeKprobes(t *testing.T, errs map[string]error, symbols ...string) *[]string {
+	t.Helper()
+	kallsyms := filepath.Join(t.TempDir(), "kallsyms")
+	var lines []string
+	for _, s := range symbols {
+		lines = append(lines, "0000000000000000 T "+s)
+	}
+	if err := os.WriteFile(kallsyms, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var tried []string
+	origAttach, origKallsyms := attachKprobe, kallsymsPath
+	t.Cleanup(func() { attachKprobe, kallsymsPath = origAttach, origKallsyms })
+	kallsymsPath = kallsyms
+	attachKprobe = func(symbol string, _ *ebpf.Program, _ *link.KprobeOptions) (link.Link, error) {
+		tried = append(tried, symbol)
+		if err := errs[symbol]; err != nil {
+			return nil, err
+		}
+		return fakeLink{}, nil
+	}
+	return &tried
+}
+
+func TestAttachKprobeSymbols(t *testing.T) {
+	missing := fmt.Errorf("symbol not found: %w", os.ErrNotExist)
+	tracefsMissing := fmt.Errorf("creating tracefs event: %w", unix.EINVAL)
+
+	tests := []struct {
+		name      string
+		errs      map[string]error
+		kallsyms  []string
+		wantTried []string
+		wantErr   error
+	}{
+		{
+			name:      "primary attaches",
+			wantTried: []string{"tcp_connect"},
+		},
+		{
+			name:      "primary missing",
+			errs:      map[string]error{"tcp_connect": missing},
+			wantTried: []string{"tcp_connect", "tcp_v4_connect"},
+		},
+		{
+			name:      "primary missing on old tracefs",
+			errs:      map[string]error{"tcp_connect": tracefsMissing},
+			kallsyms:  []string{"tcp_v4_connect"},
+			wantTried: []string{"tcp_connect", "tcp_v4_connect"},
+		},
+		{
+			name:      "EINVAL for a present symbol is a real failure",
+			errs:      map[string]error{"tcp_connect": tracefsMissing},
+			kallsyms:  []string{"tcp_connect", "tcp_v4_connect"},
+			wantTried: []string{"tcp_connect"},
+			wantErr:   unix.EINVAL,
+		},
+		{
+			name:      "permission denied",
+			errs:      map[string]error{"tcp_connect": unix.EPERM},
+			wantTried: []string{"tcp_connect"},
+			wantErr:   unix.EPERM,
+		},
+		{
+			name:      "every symbol missing returns the primary error",
+			errs:      map[string]error{"tcp_connect": missing, "tcp_v4_connect": fmt.Errorf("other: %w", os.ErrNotExist), "tcp_v6_connect": fmt.Errorf("last: %w", os.ErrNotExist)},
+			wantTried: []string{"tcp_connect", "tcp_v4_connect", "tcp_v6_connect"},
+			wantErr:   missing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tried := fakeKprobes(t, tt.errs, tt.kallsyms...)
+			_, err := attachKprobeSymbols("tcp_connect", []string{"tcp_v4_connect", "tcp_v6_connect"}, nil)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("attachKprobeSymbols: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if strings.Join(*tried, ",") != strings.Join(tt.wantTried, ",") {
+				t.Errorf("tried %v, want %v", *tried, tt.wantTried)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package ebpf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/features"
+)
+
+// Features reports which eBPF features the running kernel supports
+type Features struct {
+	Kprobe    bool `json:"kprobe"`
+	Fentry    bool `json:"fentry"`
+	PerfEvent bool `json:"perf_event"`
+	Ringbuf   bool `json:"ringbuf"`
+	BTF       bool `json:"btf"`
+
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// String formats the features as a single key=value line for logging
+func (f Features) String() string {
+	return fmt.Sprintf("kprobe=%t fentry=%t perf_event=%t ringbuf=%t btf=%t %s",
+		f.Kprobe, f.Fentry, f.PerfEvent, f.Ringbuf, f.BTF, f.Capabilities)
+}
+
+// DetectFeatures probes the kernel for supported program and map types and
+// reads the process capabilities. A probe that fails for any reason,
+// including missing privileges, reports the feature as unsupported.
+func DetectFeatures() Features {
+	_, btfErr := btf.LoadKernelSpec()
+	caps, _ := ReadCapabilities()
+	return Features{
+		Capabilities: caps,
+		Kprobe:       features.HaveProgramType(ebpf.Kprobe) == nil,
+		Fentry:       features.HaveProgramType(ebpf.Tracing) == nil && btfErr == nil,
+		PerfEvent:    features.HaveProgramType(ebpf.PerfEvent) == nil,
+		Ringbuf:      features.HaveMapType(ebpf.RingBuf) == nil,
+		BTF:          btfErr == nil,
+	}
+}
+
+// FeaturesHandler serves the detected kernel features as JSON
+func FeaturesHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(DetectFeatures())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(body, '\n'))
+}
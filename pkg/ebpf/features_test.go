@@ -0,0 +1,29 @@
+package ebpf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFeaturesHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	FeaturesHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/features", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, key := range []string{"kprobe", "fentry", "perf_event", "ringbuf", "btf", "capabilities"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("response has no %q field: %s", key, rec.Body)
+		}
+	}
+}
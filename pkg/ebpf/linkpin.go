@@ -0,0 +1,47 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// loadPinnedLink opens a pinned link, replaceable in tests
+var loadPinnedLink = link.LoadPinnedLink
+
+// attachPinnedKprobe adopts the kprobe link pinned at LinkPinPath by a previous
+// process, or attaches a new one and pins it there. With replace, as on
+// Reload, a new link is always attached and takes over the pin; the old
+// link stays attached until its previous owner closes it.
+func attachPinnedKprobe(cfg Config, prog *ebpf.Program, replace bool) (*attachment, error) {
+	path := cfg.LinkPinPath
+	if !replace {
+		l, err := loadPinnedLink(path, nil)
+		if err == nil {
+			return &attachment{links: []link.Link{l}}, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("load pinned link %s: %w", path, err)
+		}
+	}
+
+	l, err := attachKprobeSymbols(cfg.KprobeSymbol, cfg.FallbackKprobeSymbols, prog)
+	if err != nil {
+		return nil, fmt.Errorf("link kprobe: %w", err)
+	}
+	if replace {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			_ = l.Close()
+			return nil, fmt.Errorf("replace pinned link %s: %w", path, err)
+		}
+	}
+	if err := l.Pin(path); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("pin link %s (kprobe links need kernel 5.15+ to be pinnable): %w", path, err)
+	}
+	return &attachment{links: []link.Link{l}, createdPin: true}, nil
+}
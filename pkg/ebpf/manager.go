@@ -1,7 +1,16 @@
 package ebpf
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
@@ -9,9 +18,29 @@ import (
 
 // Manager manages eBPF programs and maps
 type Manager struct {
+	cfg   Config
+	stats io.Closer
+
+	mu        sync.Mutex
+	state     *loaded
+	countsMap atomic.Pointer[ebpf.Map]
+
+	// createdPins are the map pins any load created rather than reused
+	createdPins []string
+	// createdLinkPin is set when a load pinned the link rather than adopting it
+	createdLinkPin bool
+}
+
+// loaded holds the resources created by a single load of the object
+type loaded struct {
 	collection *ebpf.Collection
-	kprobeLink link.Link
+	attachment *attachment
 	countsMap  *ebpf.Map
+	events     *EventReader
+
+	loadDuration   time.Duration
+	attachDuration time.Duration
+	createdPins    []string
 }
 
 // Config holds the configuration for the eBPF manager
@@ -20,6 +49,69 @@ type Config struct {
 	ProgramName  string
 	MapName      string
 	KprobeSymbol string
+
+	// FallbackKprobeSymbols are tried in order when KprobeSymbol can't be
+	// found, e.g. tcp_v4_connect on kernels where tcp_connect isn't probeable
+	FallbackKprobeSymbols []string
+
+	// AttachType selects kprobe (default) or fentry/fexit attachment.
+	// Tracing attach types use KprobeSymbol as the target function.
+	AttachType AttachType
+
+	// PerfEvent describes the perf event used with AttachPerfEvent
+	PerfEvent *PerfEventConfig
+	// CPUMask limits AttachPerfEvent to the listed CPUs; empty means all CPUs
+	CPUMask []int
+
+	// EnableStats turns on kernel bpf_stats for as long as the manager is open
+	EnableStats bool
+
+	// EventsMapName optionally names a ringbuf map to read events from
+	EventsMapName string
+	// EventBuffer bounds the events channel; defaults to DefaultEventBuffer
+	EventBuffer int
+
+	// MapReplacements injects existing maps, e.g. pinned by another process,
+	// in place of the maps of the same name in the object. They are cloned,
+	// so the caller keeps ownership of the passed maps.
+	MapReplacements map[string]*ebpf.Map
+
+	// PinPath pins the object's maps by name under this bpffs directory,
+	// reusing pins left by a previous process so counts survive a handoff
+	PinPath string
+	// UnpinOnClose removes the map and link pins this manager created, on
+	// Close or when the load fails. Pins it reused from another process are
+	// left intact.
+	UnpinOnClose bool
+
+	// LinkPinPath pins the kprobe link at this bpffs path so the probe stays
+	// attached while the agent restarts, and adopts a link already pinned
+	// there instead of attaching. Combine it with PinPath so the adopted
+	// program keeps writing to the maps this manager reads.
+	LinkPinPath string
+
+	// MapFlags overrides the creation flags of maps by name, e.g.
+	// BPF_F_NO_PREALLOC. Maps not listed keep the object's flags.
+	MapFlags map[string]uint32
+
+	// MapMaxEntries overrides max_entries of maps by name, so maps can be
+	// sized for busy hosts without recompiling the object. For ringbuf maps
+	// the value is the buffer size in bytes.
+	MapMaxEntries map[string]uint32
+
+	// Constants sets const volatile globals of the program by name, e.g. a
+	// target port filter. Values must match the size of the variable.
+	Constants map[string]interface{}
+
+	// ExpectedPrograms and ExpectedMaps, when set, must match the object's
+	// program and map names exactly, so drift in the object fails the load
+	ExpectedPrograms []string
+	ExpectedMaps     []string
+
+	// OnLoad is called after every successful load, including reloads, with
+	// the time taken to load the spec and create the collection and the
+	// time taken to attach the program
+	OnLoad func(load, attach time.Duration)
 }
 
 // DefaultConfig returns the default configuration
@@ -34,16 +126,143 @@ func DefaultConfig() Config {
 
 // NewManager creates and initializes a new eBPF manager
 func NewManager(cfg Config) (*Manager, error) {
+	return NewManagerContext(context.Background(), cfg)
+}
+
+// NewManagerContext is like NewManager but returns as soon as ctx is done.
+// Loading can't be interrupted inside the kernel, so a load that completes
+// after cancellation is cleaned up in the background.
+func NewManagerContext(ctx context.Context, cfg Config) (*Manager, error) {
+	type result struct {
+		m   *Manager
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		m, err := newManager(ctx, cfg)
+		done <- result{m, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.m, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.m != nil {
+				_ = r.m.Close()
+			}
+		}()
+		return nil, fmt.Errorf("load cancelled: %w", ctx.Err())
+	}
+}
+
+// Load steps, replaceable in tests
+var (
+	loadState          = load
+	startStats         = enableStats
+	loadCollectionSpec = ebpf.LoadCollectionSpec
+)
+
+// newManager loads the object and builds the manager, checking ctx between stages
+func newManager(ctx context.Context, cfg Config) (*Manager, error) {
+	state, err := loadState(ctx, cfg, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats io.Closer
+	if cfg.EnableStats {
+		stats, err = startStats()
+		if err != nil {
+			_ = state.close()
+			if cfg.UnpinOnClose {
+				_ = unpin(cfg.PinPath, state.createdPins)
+			}
+			// The probe would otherwise stay attached with no owner
+			if state.attachment != nil && state.attachment.createdPin {
+				_ = os.Remove(cfg.LinkPinPath)
+			}
+			return nil, err
+		}
+	}
+
+	m := &Manager{
+		cfg:         cfg,
+		stats:       stats,
+		state:       state,
+		createdPins: state.createdPins,
+
+		createdLinkPin: state.attachment.createdPin,
+	}
+	m.countsMap.Store(state.countsMap)
+	m.observeLoad(state)
+	return m, nil
+}
+
+// observeLoad reports the durations of a successful load to OnLoad
+func (m *Manager) observeLoad(state *loaded) {
+	if m.cfg.OnLoad != nil {
+		m.cfg.OnLoad(state.loadDuration, state.attachDuration)
+	}
+}
+
+// load loads the object, attaches the program and looks up its maps
+func load(ctx context.Context, cfg Config, reload bool) (state *loaded, err error) {
+	if err := validateObjectPath(cfg.ObjectPath); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+
 	// Load the BPF object from disk
-	spec, err := ebpf.LoadCollectionSpec(cfg.ObjectPath)
+	spec, err := loadCollectionSpec(cfg.ObjectPath)
 	if err != nil {
 		return nil, fmt.Errorf("load spec: %w", err)
 	}
 
-	coll, err := ebpf.NewCollection(spec)
+	if err := validateExpected(spec, cfg.ExpectedPrograms, cfg.ExpectedMaps); err != nil {
+		return nil, err
+	}
+
+	if err := prepareProgramSpec(cfg, spec); err != nil {
+		return nil, err
+	}
+	if err := applyMapFlags(spec, cfg.MapFlags); err != nil {
+		return nil, err
+	}
+	if err := applyMapMaxEntries(spec, cfg.MapMaxEntries); err != nil {
+		return nil, err
+	}
+	if err := applyConstants(spec, cfg.Constants); err != nil {
+		return nil, err
+	}
+
+	createdPins, err := preparePins(spec, cfg.PinPath, cfg.MapReplacements)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.UnpinOnClose {
+		defer func() {
+			if err != nil {
+				_ = unpin(cfg.PinPath, createdPins)
+			}
+		}()
+	}
+
+	coll, err := ebpf.NewCollectionWithOptions(spec, ebpf.CollectionOptions{
+		Maps:            ebpf.MapOptions{PinPath: cfg.PinPath},
+		MapReplacements: cfg.MapReplacements,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("new collection: %w", err)
 	}
+	loadDuration := time.Since(start)
+
+	// Don't attach if shutdown was requested while the collection loaded
+	if err := ctx.Err(); err != nil {
+		coll.Close()
+		return nil, err
+	}
 
 	prog := coll.Programs[cfg.ProgramName]
 	if prog == nil {
@@ -51,43 +270,217 @@ func NewManager(cfg Config) (*Manager, error) {
 		return nil, fmt.Errorf("program %q not found", cfg.ProgramName)
 	}
 
-	// Attach kprobe
-	l, err := link.Kprobe(cfg.KprobeSymbol, prog, nil)
+	start = time.Now()
+	att, err := attachProgram(cfg, prog, reload)
 	if err != nil {
 		coll.Close()
-		return nil, fmt.Errorf("link kprobe: %w", err)
+		return nil, err
+	}
+	if att.createdPin {
+		// A failed load would otherwise leave the probe attached with no owner
+		defer func() {
+			if err != nil {
+				_ = os.Remove(cfg.LinkPinPath)
+			}
+		}()
+	}
+
+	state = &loaded{
+		collection:     coll,
+		attachment:     att,
+		loadDuration:   loadDuration,
+		attachDuration: time.Since(start),
+		createdPins:    createdPins,
 	}
 
 	// Get map handle
-	counts := coll.Maps[cfg.MapName]
-	if counts == nil {
-		_ = l.Close()
-		coll.Close()
+	state.countsMap = coll.Maps[cfg.MapName]
+	if state.countsMap == nil {
+		_ = state.close()
 		return nil, fmt.Errorf("map %q not found", cfg.MapName)
 	}
 
-	return &Manager{
-		collection: coll,
-		kprobeLink: l,
-		countsMap:  counts,
-	}, nil
+	if cfg.EventsMapName != "" {
+		eventsMap := coll.Maps[cfg.EventsMapName]
+		if eventsMap == nil {
+			_ = state.close()
+			return nil, fmt.Errorf("map %q not found", cfg.EventsMapName)
+		}
+		state.events, err = NewEventReader(eventsMap, cfg.EventBuffer)
+		if err != nil {
+			_ = state.close()
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// close releases the loaded resources
+func (l *loaded) close() error {
+	var err error
+	if l.events != nil {
+		if e := l.events.Close(); e != nil {
+			err = e
+		}
+	}
+	if l.attachment != nil {
+		if e := l.attachment.close(); e != nil {
+			err = e
+		}
+	}
+	if l.collection != nil {
+		l.collection.Close()
+	}
+	return err
 }
 
-// GetCountsMap returns the counts map
+// GetCountsMap returns the counts map. After a Reload it returns the new
+// map, so long-lived readers should call it each time rather than caching it.
 func (m *Manager) GetCountsMap() *ebpf.Map {
-	return m.countsMap
+	return m.countsMap.Load()
+}
+
+// GetMap returns the named map of the loaded object, or nil if there is none.
+// Like GetCountsMap, it should be called each time as Reload replaces it.
+func (m *Manager) GetMap(name string) *ebpf.Map {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		return nil
+	}
+	return m.state.collection.Maps[name]
+}
+
+// GetEvents returns the ringbuf event reader, or nil if none is configured
+func (m *Manager) GetEvents() *EventReader {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		return nil
+	}
+	return m.state.events
+}
+
+// Ping checks that the program is still attached and the counts map is usable
+func (m *Manager) Ping() error {
+	m.mu.Lock()
+	state := m.state
+	m.mu.Unlock()
+
+	if state == nil {
+		return fmt.Errorf("manager is closed")
+	}
+	if err := state.checkAttached(); err != nil {
+		return err
+	}
+	if _, err := state.countsMap.Info(); err != nil {
+		return fmt.Errorf("map info: %w", err)
+	}
+	return nil
+}
+
+// checkAttached checks the program has links and that each is still usable
+func (l *loaded) checkAttached() error {
+	if l.attachment == nil || len(l.attachment.links) == 0 {
+		return fmt.Errorf("program is not attached")
+	}
+	for _, lnk := range l.attachment.links {
+		if err := checkLink(lnk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attached reports whether the program is still attached, as checked by Ping
+func (l *loaded) attached() bool {
+	return l.checkAttached() == nil
+}
+
+// checkLink checks the link is still usable. Kprobe links attached through
+// the perf_event ioctl, as on kernels before 5.15, don't support Info; the
+// link holding an open FD is all that can be checked, so they pass.
+func checkLink(l link.Link) error {
+	if _, err := l.Info(); err != nil && !errors.Is(err, ebpf.ErrNotSupported) {
+		return fmt.Errorf("link info: %w", err)
+	}
+	return nil
+}
+
+// Reload loads and attaches a fresh copy of the object, then swaps it in
+// and releases the previous one. On error the current program stays attached.
+func (m *Manager) Reload() error {
+	next, err := load(context.Background(), m.cfg, true)
+	if err != nil {
+		return fmt.Errorf("reload: %w", err)
+	}
+
+	prev, err := m.swap(next)
+	if err != nil {
+		_ = next.close()
+		return fmt.Errorf("reload: %w", err)
+	}
+	m.observeLoad(next)
+
+	if err := prev.close(); err != nil {
+		return fmt.Errorf("close previous: %w", err)
+	}
+	return nil
+}
+
+// swap replaces the loaded state with next and returns the previous one.
+// Map pins next created are added to the ones the manager owns, and a link
+// pin next created replaces the old one, so the manager now owns it.
+func (m *Manager) swap(next *loaded) (*loaded, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prev := m.state
+	if prev == nil {
+		return nil, fmt.Errorf("manager is closed")
+	}
+	m.state = next
+	m.countsMap.Store(next.countsMap)
+	for _, name := range next.createdPins {
+		if !slices.Contains(m.createdPins, name) {
+			m.createdPins = append(m.createdPins, name)
+		}
+	}
+	if next.attachment != nil && next.attachment.createdPin {
+		m.createdLinkPin = true
+	}
+	return prev, nil
 }
 
 // Close cleans up resources
 func (m *Manager) Close() error {
+	m.mu.Lock()
+	state := m.state
+	m.state = nil
+	m.countsMap.Store(nil)
+	createdPins := m.createdPins
+	createdLinkPin := m.createdLinkPin
+	m.mu.Unlock()
+
 	var err error
-	if m.kprobeLink != nil {
-		if e := m.kprobeLink.Close(); e != nil {
+	if state != nil {
+		err = state.close()
+	}
+	if m.stats != nil {
+		if e := m.stats.Close(); e != nil {
 			err = e
 		}
 	}
-	if m.collection != nil {
-		m.collection.Close()
+	if state != nil && m.cfg.UnpinOnClose {
+		if e := unpin(m.cfg.PinPath, createdPins); e != nil {
+			err = e
+		}
+		if createdLinkPin {
+			if e := os.Remove(m.cfg.LinkPinPath); e != nil && !errors.Is(e, fs.ErrNotExist) {
+				err = fmt.Errorf("unpin link: %w", e)
+			}
+		}
 	}
 	return err
 }
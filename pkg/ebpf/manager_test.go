@@ -0,0 +1,249 @@
+package ebpf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/link"
+)
+
+// fakeLink is a link whose Info returns err
+type fakeLink struct {
+	link.Link
+	err error
+}
+
+func (l fakeLink) Info() (*link.Info, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	return &link.Info{}, nil
+}
+
+func (fakeLink) Close() error { return nil }
+
+func TestCheckLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{"info", nil, false},
+		{"perf event ioctl link", fmt.Errorf("info: %w", ebpf.ErrNotSupported), false},
+		{"closed", errors.New("bad file descriptor"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkLink(fakeLink{err: tt.err})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkLink() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// exists reports whether path exists
+func exists(t *testing.T, path string) bool {
+	t.Helper()
+	_, err := os.Stat(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("stat %s: %v", path, err)
+	}
+	return err == nil
+}
+
+// touch creates an empty file standing in for a bpffs pin
+func touch(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadTakesOverLinkPin(t *testing.T) {
+	linkPin := filepath.Join(t.TempDir(), "link")
+	touch(t, linkPin)
+
+	// The first load adopted the pin of a previous process
+	m := &Manager{
+		cfg:   Config{LinkPinPath: linkPin, UnpinOnClose: true},
+		state: &loaded{attachment: &attachment{}},
+	}
+	prev, err := m.swap(&loaded{attachment: &attachment{createdPin: true}})
+	if err != nil {
+		t.Fatalf("swap: %v", err)
+	}
+	if prev == nil {
+		t.Fatal("swap returned no previous state")
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if exists(t, linkPin) {
+		t.Error("Close left the link pin the reload created")
+	}
+}
+
+func TestSwapClosedManager(t *testing.T) {
+	m := &Manager{}
+	if _, err := m.swap(&loaded{}); err == nil {
+		t.Error("swap succeeded on a closed manager")
+	}
+}
+
+func TestReloadOwnsCreatedMapPins(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"counts", "shared", "extra"} {
+		touch(t, filepath.Join(dir, name))
+	}
+
+	// "shared" was pinned by another process and must survive Close
+	m := &Manager{
+		cfg:         Config{PinPath: dir, UnpinOnClose: true},
+		state:       &loaded{attachment: &attachment{}},
+		createdPins: []string{"counts"},
+	}
+	if _, err := m.swap(&loaded{attachment: &attachment{}, createdPins: []string{"extra"}}); err != nil {
+		t.Fatalf("swap: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	for name, want := range map[string]bool{"counts": false, "extra": false, "shared": true} {
+		if got := exists(t, filepath.Join(dir, name)); got != want {
+			t.Errorf("pin %s exists = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestStatsFailureRemovesCreatedLinkPin(t *testing.T) {
+	origLoad, origStats := loadState, startStats
+	t.Cleanup(func() { loadState, startStats = origLoad, origStats })
+	startStats = func() (io.Closer, error) { return nil, errors.New("enable stats: boom") }
+
+	for _, created := range []bool{true, false} {
+		t.Run(fmt.Sprintf("created=%v", created), func(t *testing.T) {
+			linkPin := filepath.Join(t.TempDir(), "link")
+			touch(t, linkPin)
+			loadState = func(context.Context, Config, bool) (*loaded, error) {
+				return &loaded{attachment: &attachment{createdPin: created}}, nil
+			}
+
+			if _, err := newManager(context.Background(), Config{LinkPinPath: linkPin, EnableStats: true}); err == nil {
+				t.Fatal("newManager succeeded with failing stats")
+			}
+			// A pin adopted from a previous process is left for the next start
+			if got := exists(t, linkPin); got == created {
+				t.Errorf("link pin exists = %v after failed start, want %v", got, !created)
+			}
+		})
+	}
+}
+
+// fakeObject makes load read spec instead of parsing an ELF object,
+// returning the object path to configure
+func fakeObject(t *testing.T, spec *ebpf.CollectionSpec) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "prog.bpf.o")
+	if err := os.WriteFile(path, elfMagic, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	orig := loadCollectionSpec
+	t.Cleanup(func() { loadCollectionSpec = orig })
+	loadCollectionSpec = func(string) (*ebpf.CollectionSpec, error) { return spec.Copy(), nil }
+	return path
+}
+
+// countingSpec is an object with a kprobe program referencing the counts map
+func countingSpec() *ebpf.CollectionSpec {
+	return &ebpf.CollectionSpec{
+		Maps: map[string]*ebpf.MapSpec{
+			"counts": {Name: "counts", Type: ebpf.Hash, KeySize: 4, ValueSize: 8, MaxEntries: 16},
+		},
+		Programs: map[string]*ebpf.ProgramSpec{
+			"trace_connect": {
+				Name:    "trace_connect",
+				Type:    ebpf.Kprobe,
+				License: "GPL",
+				Instructions: asm.Instructions{
+					asm.LoadMapPtr(asm.R1, 0).WithReference("counts"),
+					asm.Mov.Imm(asm.R0, 0),
+					asm.Return(),
+				},
+			},
+		},
+	}
+}
+
+func TestLoadUsesMapReplacements(t *testing.T) {
+	replacement := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: 8, MaxEntries: 16})
+	fakeKprobes(t, nil, "tcp_connect")
+	cfg := Config{
+		ObjectPath:      fakeObject(t, countingSpec()),
+		ProgramName:     "trace_connect",
+		MapName:         "counts",
+		KprobeSymbol:    "tcp_connect",
+		MapReplacements: map[string]*ebpf.Map{"counts": replacement},
+	}
+
+	state, err := load(context.Background(), cfg, false)
+	if err != nil {
+		t.Skipf("load: %v", err)
+	}
+	defer state.close()
+
+	want, err := replacement.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantID, _ := want.ID()
+	info, err := state.collection.Programs["trace_connect"].Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, _ := info.MapIDs()
+	if len(ids) != 1 || ids[0] != wantID {
+		t.Errorf("program uses maps %v, want the replacement %d", ids, wantID)
+	}
+	got, err := state.countsMap.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := got.ID(); id != wantID {
+		t.Errorf("counts map ID = %d, want the replacement %d", id, wantID)
+	}
+}
+
+func TestPreparePinsSkipsReplacedMaps(t *testing.T) {
+	dir := t.TempDir()
+	// The replaced map's pin belongs to the process that created it
+	touch(t, filepath.Join(dir, "counts"))
+	spec := &ebpf.CollectionSpec{Maps: map[string]*ebpf.MapSpec{"counts": {}, "events": {}}}
+
+	created, err := preparePins(spec, dir, map[string]*ebpf.Map{"counts": {}})
+	if err != nil {
+		t.Fatalf("preparePins: %v", err)
+	}
+	if len(created) != 1 || created[0] != "events" {
+		t.Errorf("created pins = %v, want only events", created)
+	}
+	if spec.Maps["counts"].Pinning != ebpf.PinNone {
+		t.Error("replaced map marked for pinning")
+	}
+	if err := unpin(dir, created); err != nil {
+		t.Fatalf("unpin: %v", err)
+	}
+	if !exists(t, filepath.Join(dir, "counts")) {
+		t.Error("unpinning the created pins removed the replaced map's pin")
+	}
+}
@@ -0,0 +1,39 @@
+package ebpf
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// applyMapFlags overrides the flags of the named map specs, rejecting
+// combinations the kernel would refuse for the map type
+func applyMapFlags(spec *ebpf.CollectionSpec, flags map[string]uint32) error {
+	for name, f := range flags {
+		ms := spec.Maps[name]
+		if ms == nil {
+			return fmt.Errorf("map flags: map %q not found", name)
+		}
+		if err := validateMapFlags(ms.Type, f); err != nil {
+			return fmt.Errorf("map flags for %q: %w", name, err)
+		}
+		ms.Flags = f
+	}
+	return nil
+}
+
+// validateMapFlags checks flags that are only valid for some map types
+func validateMapFlags(typ ebpf.MapType, flags uint32) error {
+	if flags&unix.BPF_F_NO_PREALLOC != 0 {
+		switch typ {
+		case ebpf.Hash, ebpf.PerCPUHash, ebpf.HashOfMaps, ebpf.LPMTrie:
+		default:
+			return fmt.Errorf("BPF_F_NO_PREALLOC is not supported for %s maps", typ)
+		}
+	}
+	if flags&unix.BPF_F_MMAPABLE != 0 && typ != ebpf.Array {
+		return fmt.Errorf("BPF_F_MMAPABLE is only supported for Array maps, not %s", typ)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+func TestApplyMapFlags(t *testing.T) {
+	spec := &ebpf.CollectionSpec{Maps: map[string]*ebpf.MapSpec{
+		"counts": {Type: ebpf.Hash},
+		"totals": {Type: ebpf.Array},
+	}}
+	if err := applyMapFlags(spec, map[string]uint32{"counts": unix.BPF_F_NO_PREALLOC, "totals": unix.BPF_F_MMAPABLE}); err != nil {
+		t.Fatalf("applyMapFlags: %v", err)
+	}
+	if spec.Maps["counts"].Flags != unix.BPF_F_NO_PREALLOC || spec.Maps["totals"].Flags != unix.BPF_F_MMAPABLE {
+		t.Errorf("flags not applied: counts %#x, totals %#x", spec.Maps["counts"].Flags, spec.Maps["totals"].Flags)
+	}
+
+	for _, bad := range []map[string]uint32{
+		{"missing": 0},
+		{"totals": unix.BPF_F_NO_PREALLOC},
+		{"counts": unix.BPF_F_MMAPABLE},
+	} {
+		if err := applyMapFlags(spec, bad); err == nil {
+			t.Errorf("applyMapFlags(%v) returned no error", bad)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package ebpf
+
+import (
+	"fmt"
+	"math/bits"
+	"os"
+
+	"github.com/cilium/ebpf"
+)
+
+const (
+	// maxHashEntries keeps the kernel's power of two hash bucket count,
+	// 16 bytes each, within a u32 allocation
+	maxHashEntries = 1 << 28
+	// maxArrayEntries is the largest size the kernel's array index mask allows
+	maxArrayEntries = 1 << 31
+)
+
+// applyMapMaxEntries overrides the max_entries of the named map specs
+func applyMapMaxEntries(spec *ebpf.CollectionSpec, maxEntries map[string]uint32) error {
+	for name, n := range maxEntries {
+		ms := spec.Maps[name]
+		if ms == nil {
+			return fmt.Errorf("map max entries: map %q not found", name)
+		}
+		if err := validateMaxEntries(ms.Type, n); err != nil {
+			return fmt.Errorf("map max entries for %q: %w", name, err)
+		}
+		ms.MaxEntries = n
+	}
+	return nil
+}
+
+// validateMaxEntries checks n against the limits the kernel enforces for typ
+func validateMaxEntries(typ ebpf.MapType, n uint32) error {
+	if n == 0 {
+		return fmt.Errorf("must be nonzero")
+	}
+	switch typ {
+	case ebpf.Hash, ebpf.PerCPUHash, ebpf.LRUHash, ebpf.LRUCPUHash, ebpf.HashOfMaps:
+		if n > maxHashEntries {
+			return fmt.Errorf("%d exceeds the limit of %d for %s maps", n, maxHashEntries, typ)
+		}
+	case ebpf.Array, ebpf.PerCPUArray, ebpf.ArrayOfMaps:
+		if n > maxArrayEntries {
+			return fmt.Errorf("%d exceeds the limit of %d for %s maps", n, maxArrayEntries, typ)
+		}
+	case ebpf.RingBuf:
+		// The size is in bytes and must be a power of two number of pages
+		if bits.OnesCount32(n) != 1 || n%uint32(os.Getpagesize()) != 0 {
+			return fmt.Errorf("%d must be a power of two multiple of the page size for %s maps", n, typ)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package ebpf
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+func TestApplyMapMaxEntries(t *testing.T) {
+	spec := &ebpf.CollectionSpec{Maps: map[string]*ebpf.MapSpec{
+		"counts": {Type: ebpf.Hash, KeySize: 4, ValueSize: 8, MaxEntries: 1024},
+		"events": {Type: ebpf.RingBuf, MaxEntries: 1 << 16},
+	}}
+	if err := applyMapMaxEntries(spec, nil); err != nil {
+		t.Fatalf("no overrides: %v", err)
+	}
+	if got := spec.Maps["counts"].MaxEntries; got != 1024 {
+		t.Errorf("counts max entries = %d without overrides, want 1024", got)
+	}
+
+	if err := applyMapMaxEntries(spec, map[string]uint32{"counts": 65536}); err != nil {
+		t.Fatalf("applyMapMaxEntries: %v", err)
+	}
+	m := newTestMap(t, spec.Maps["counts"])
+	if got := m.MaxEntries(); got != 65536 {
+		t.Errorf("created map max entries = %d, want 65536", got)
+	}
+	info, err := m.Info()
+	if err != nil {
+		t.Fatalf("map info: %v", err)
+	}
+	if info.MaxEntries != 65536 {
+		t.Errorf("kernel reports max entries %d, want 65536", info.MaxEntries)
+	}
+
+	page := uint32(os.Getpagesize())
+	for _, bad := range []map[string]uint32{
+		{"missing": 10},
+		{"counts": 0},
+		{"counts": maxHashEntries + 1},
+		{"events": 3 * page},
+		{"events": page + 1},
+	} {
+		if err := applyMapMaxEntries(spec, bad); err == nil {
+			t.Errorf("applyMapMaxEntries(%v) returned no error", bad)
+		}
+	}
+	if got := spec.Maps["counts"].MaxEntries; got != 65536 {
+		t.Errorf("counts max entries = %d after rejected overrides, want 65536 unchanged", got)
+	}
+	if err := validateMaxEntries(ebpf.RingBuf, 4*page); err != nil {
+		t.Errorf("four pages ringbuf: %v", err)
+	}
+	if err := validateMaxEntries(ebpf.Array, maxArrayEntries); err != nil {
+		t.Errorf("largest array: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package ebpf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrInvalidObjectPath is returned when ObjectPath does not point to a readable BPF ELF object
+var ErrInvalidObjectPath = errors.New("invalid object path")
+
+// elfMagic is the header every BPF object file starts with
+var elfMagic = []byte{0x7f, 'E', 'L', 'F'}
+
+// validateObjectPath checks path is a regular, readable ELF file
+func validateObjectPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%w %q: %w", ErrInvalidObjectPath, path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w %q: is a directory", ErrInvalidObjectPath, path)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%w %q: not a regular file (mode %s)", ErrInvalidObjectPath, path, info.Mode())
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w %q: %w", ErrInvalidObjectPath, path, err)
+	}
+	defer f.Close()
+
+	header := make([]byte, len(elfMagic))
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header, elfMagic) {
+		return fmt.Errorf("%w %q: not an ELF object file", ErrInvalidObjectPath, path)
+	}
+	return nil
+}
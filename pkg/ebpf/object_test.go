@@ -0,0 +1,38 @@
+package ebpf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewManagerInvalidObjectPath(t *testing.T) {
+	dir := t.TempDir()
+	notBPF := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notBPF, []byte("not an object\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"missing", filepath.Join(dir, "missing.o"), "no such file"},
+		{"directory", dir, "is a directory"},
+		{"not BPF", notBPF, "not an ELF object file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewManager(Config{ObjectPath: tt.path})
+			if !errors.Is(err, ErrInvalidObjectPath) {
+				t.Fatalf("NewManager(%q) error = %v, want ErrInvalidObjectPath", tt.path, err)
+			}
+			if !strings.Contains(err.Error(), tt.path) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("NewManager(%q) error = %q, want the path and %q", tt.path, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package ebpf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
+)
+
+// PerfEventConfig describes a sampling perf event to attach the program to,
+// e.g. Type PERF_TYPE_SOFTWARE with Config PERF_COUNT_SW_CPU_CLOCK
+type PerfEventConfig struct {
+	// Type is the perf event type (unix.PERF_TYPE_*)
+	Type uint32
+	// Config selects the event within the type (e.g. unix.PERF_COUNT_SW_*)
+	Config uint64
+	// SamplePeriod is the number of events between samples
+	SamplePeriod uint64
+}
+
+// validate checks the perf event configuration is usable
+func (p *PerfEventConfig) validate() error {
+	if p == nil {
+		return fmt.Errorf("perf event attach requires a PerfEvent config")
+	}
+	switch p.Type {
+	case unix.PERF_TYPE_SOFTWARE:
+		if p.Config >= unix.PERF_COUNT_SW_MAX {
+			return fmt.Errorf("perf event: invalid software event config %d", p.Config)
+		}
+	case unix.PERF_TYPE_HARDWARE:
+		if p.Config >= unix.PERF_COUNT_HW_MAX {
+			return fmt.Errorf("perf event: invalid hardware event config %d", p.Config)
+		}
+	default:
+		return fmt.Errorf("perf event: unsupported type %d (only software and hardware events)", p.Type)
+	}
+	if p.SamplePeriod == 0 {
+		return fmt.Errorf("perf event: sample period must be greater than zero")
+	}
+	return nil
+}
+
+// validateCPUs checks every CPU in mask is online and listed once
+func validateCPUs(mask, online []int) error {
+	seen := make(map[int]bool, len(mask))
+	for _, cpu := range mask {
+		if !slices.Contains(online, cpu) {
+			return fmt.Errorf("cpu mask: cpu %d is not online (online cpus: %v)", cpu, online)
+		}
+		if seen[cpu] {
+			return fmt.Errorf("cpu mask: cpu %d listed more than once", cpu)
+		}
+		seen[cpu] = true
+	}
+	return nil
+}
+
+// onlineCPUsPath lists the online CPUs, replaceable in tests
+var onlineCPUsPath = "/sys/devices/system/cpu/online"
+
+// onlineCPUs returns the ids of the online CPUs. runtime.NumCPU counts the
+// CPUs the process may run on, which under a cpuset are neither all of them
+// nor numbered from zero.
+func onlineCPUs() ([]int, error) {
+	data, err := os.ReadFile(onlineCPUsPath)
+	if err != nil {
+		return nil, fmt.Errorf("read online cpus: %w", err)
+	}
+	cpus, err := parseCPUList(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", onlineCPUsPath, err)
+	}
+	return cpus, nil
+}
+
+// parseCPUList parses a kernel CPU list such as "0-3,8,10-11"
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		lo, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu %q", part)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(last); err != nil || hi < lo {
+				return nil, fmt.Errorf("invalid cpu range %q", part)
+			}
+		}
+		for cpu := lo; cpu <= hi; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// attachPerfEvent opens the perf event on each CPU in mask, or on every CPU
+// when mask is empty, and attaches prog to each
+func attachPerfEvent(p *PerfEventConfig, mask []int, prog *ebpf.Program) (*attachment, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	online, err := onlineCPUs()
+	if err != nil {
+		return nil, err
+	}
+	cpus := mask
+	if len(cpus) == 0 {
+		cpus = online
+	} else if err := validateCPUs(cpus, online); err != nil {
+		return nil, err
+	}
+
+	att := &attachment{}
+	for _, cpu := range cpus {
+		if err := att.addPerfEvent(p, cpu, prog); err != nil {
+			_ = att.close()
+			return nil, err
+		}
+	}
+	return att, nil
+}
+
+// addPerfEvent opens the perf event on cpu and links prog to it
+func (a *attachment) addPerfEvent(p *PerfEventConfig, cpu int, prog *ebpf.Program) error {
+	attr := unix.PerfEventAttr{
+		Type:   p.Type,
+		Config: p.Config,
+		Size:   uint32(unsafe.Sizeof(unix.PerfEventAttr{})),
+		Sample: p.SamplePeriod,
+	}
+	fd, err := unix.PerfEventOpen(&attr, -1, cpu, -1, unix.PERF_FLAG_FD_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("perf_event_open on cpu %d: %w", cpu, err)
+	}
+	file := os.NewFile(uintptr(fd), fmt.Sprintf("perf_event:cpu%d", cpu))
+
+	l, err := link.AttachRawLink(link.RawLinkOptions{
+		Target:  fd,
+		Program: prog,
+		Attach:  ebpf.AttachPerfEvent,
+	})
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("link perf event on cpu %d: %w", cpu, err)
+	}
+
+	a.links = append(a.links, l)
+	a.closers = append(a.closers, io.Closer(file))
+	return nil
+}
@@ -0,0 +1,88 @@
+package ebpf
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []int
+		wantErr bool
+	}{
+		{list: "0", want: []int{0}},
+		{list: "0-3", want: []int{0, 1, 2, 3}},
+		{list: "2-3,6,8-9", want: []int{2, 3, 6, 8, 9}},
+		{list: "", wantErr: true},
+		{list: "3-1", wantErr: true},
+		{list: "0-x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCPUList(tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCPUList(%q) error = %v, wantErr %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseCPUList(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+// fakeOnlineCPUs replaces the online CPU list with list
+func fakeOnlineCPUs(t *testing.T, list string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "online")
+	if err := os.WriteFile(path, []byte(list+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	orig := onlineCPUsPath
+	t.Cleanup(func() { onlineCPUsPath = orig })
+	onlineCPUsPath = path
+}
+
+func TestOnlineCPUs(t *testing.T) {
+	fakeOnlineCPUs(t, "4-5,7")
+	cpus, err := onlineCPUs()
+	if err != nil {
+		t.Fatalf("onlineCPUs: %v", err)
+	}
+	if want := []int{4, 5, 7}; !slices.Equal(cpus, want) {
+		t.Errorf("onlineCPUs() = %v, want %v", cpus, want)
+	}
+}
+
+func TestValidateCPUs(t *testing.T) {
+	online := []int{2, 3, 6}
+	tests := []struct {
+		name    string
+		mask    []int
+		wantErr bool
+	}{
+		{"online", []int{2, 6}, false},
+		{"offline gap", []int{4}, true},
+		{"below the first online cpu", []int{0}, true},
+		{"negative", []int{-1}, true},
+		{"duplicate", []int{3, 3}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCPUs(tt.mask, online); (err != nil) != tt.wantErr {
+				t.Errorf("validateCPUs(%v) = %v, wantErr %v", tt.mask, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAttachPerfEventRejectsOfflineCPU(t *testing.T) {
+	fakeOnlineCPUs(t, "2-3")
+	p := &PerfEventConfig{Type: unix.PERF_TYPE_SOFTWARE, Config: unix.PERF_COUNT_SW_CPU_CLOCK, SamplePeriod: 1000}
+	if _, err := attachPerfEvent(p, []int{0}, nil); err == nil {
+		t.Error("attachPerfEvent accepted a CPU that is not online")
+	}
+}
@@ -0,0 +1,49 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+// preparePins marks the object's maps to be pinned by name under dir,
+// skipping global data sections and replaced maps. It returns the maps
+// that have no pin yet, i.e. the pins this load will create rather than reuse.
+func preparePins(spec *ebpf.CollectionSpec, dir string, replaced map[string]*ebpf.Map) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	var created []string
+	for name, ms := range spec.Maps {
+		if strings.HasPrefix(name, ".") || replaced[name] != nil {
+			continue
+		}
+		ms.Pinning = ebpf.PinByName
+
+		_, err := os.Stat(filepath.Join(dir, name))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			created = append(created, name)
+		case err != nil:
+			return nil, fmt.Errorf("pin %q: %w", name, err)
+		}
+	}
+	return created, nil
+}
+
+// unpin removes the named pins under dir, ignoring ones already gone
+func unpin(dir string, names []string) error {
+	var err error
+	for _, name := range names {
+		if e := os.Remove(filepath.Join(dir, name)); e != nil && !errors.Is(e, fs.ErrNotExist) {
+			err = fmt.Errorf("unpin %q: %w", name, e)
+		}
+	}
+	return err
+}
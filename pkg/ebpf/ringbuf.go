@@ -0,0 +1,111 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+// DefaultEventBuffer is the number of events buffered for a slow consumer
+const DefaultEventBuffer = 1024
+
+// eventReaderCloseTimeout bounds how long Close waits for the pending read
+var eventReaderCloseTimeout = 5 * time.Second
+
+// recordReader is the part of *ringbuf.Reader used by EventReader
+type recordReader interface {
+	Read() (ringbuf.Record, error)
+	Close() error
+}
+
+// EventReader drains a ringbuf map into a bounded channel. When the consumer
+// falls behind, events are dropped and counted rather than blocking the
+// reader, so the kernel-side ring buffer keeps draining under load.
+type EventReader struct {
+	reader  recordReader
+	events  chan []byte
+	dropped atomic.Uint64
+	done    chan struct{}
+}
+
+// NewEventReader starts reading events from the ringbuf map m
+func NewEventReader(m *ebpf.Map, buffer int) (*EventReader, error) {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+
+	rd, err := ringbuf.NewReader(m)
+	if err != nil {
+		return nil, fmt.Errorf("new ringbuf reader: %w", err)
+	}
+
+	return startEventReader(rd, buffer), nil
+}
+
+// startEventReader starts draining rd into a channel of buffer events
+func startEventReader(rd recordReader, buffer int) *EventReader {
+	r := &EventReader{
+		reader: rd,
+		events: make(chan []byte, buffer),
+		done:   make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Events returns the channel of raw event records. It is closed when the reader stops.
+func (r *EventReader) Events() <-chan []byte {
+	return r.events
+}
+
+// Dropped returns the number of events dropped because the consumer was too slow
+func (r *EventReader) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+// Close stops the reader and waits, for a bounded time, for the pending
+// read to return. The Manager calls it before the underlying map is closed.
+func (r *EventReader) Close() error {
+	// ringbuf.Reader.Close blocks until the pending Read returns
+	closed := make(chan error, 1)
+	go func() { closed <- r.reader.Close() }()
+	select {
+	case err := <-closed:
+		<-r.done
+		return err
+	case <-time.After(eventReaderCloseTimeout):
+		return fmt.Errorf("ringbuf reader did not stop within %s", eventReaderCloseTimeout)
+	}
+}
+
+// run reads records until the reader is closed
+func (r *EventReader) run() {
+	defer close(r.done)
+	defer close(r.events)
+
+	for {
+		rec, err := r.reader.Read()
+		if err != nil {
+			if errors.Is(err, ringbuf.ErrClosed) {
+				return
+			}
+			log.Printf("ringbuf read error: %v", err)
+			continue
+		}
+		r.offer(rec.RawSample)
+	}
+}
+
+// offer hands an event to the consumer without blocking, dropping it when the channel is full
+func (r *EventReader) offer(sample []byte) {
+	select {
+	case r.events <- sample:
+	default:
+		r.dropped.Add(1)
+	}
+}
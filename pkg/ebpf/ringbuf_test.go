@@ -0,0 +1,74 @@
+package ebpf
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+func TestEventReaderCountsDrops(t *testing.T) {
+	r := &EventReader{events: make(chan []byte, 2)}
+	for i := 0; i < 5; i++ {
+		r.offer([]byte{byte(i)})
+	}
+	if got := r.Dropped(); got != 3 {
+		t.Errorf("Dropped() = %d, want 3 with a buffer of 2", got)
+	}
+	if got := <-r.Events(); got[0] != 0 {
+		t.Errorf("first event = %v, want the oldest kept", got)
+	}
+}
+
+func TestEventReaderClose(t *testing.T) {
+	r, err := NewEventReader(newTestMap(t, &ebpf.MapSpec{Type: ebpf.RingBuf, MaxEntries: uint32(os.Getpagesize())}), 0)
+	if err != nil {
+		t.Fatalf("NewEventReader: %v", err)
+	}
+	if cap(r.events) != DefaultEventBuffer {
+		t.Errorf("buffer = %d, want the default %d", cap(r.events), DefaultEventBuffer)
+	}
+
+	start := time.Now()
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= eventReaderCloseTimeout {
+		t.Errorf("Close took %s, want it to return before the timeout", elapsed)
+	}
+	if _, ok := <-r.Events(); ok {
+		t.Error("events channel still open after Close")
+	}
+}
+
+// stuckReader is a record reader whose Close blocks, like one waiting on a
+// Read that doesn't return, until release is closed
+type stuckReader struct {
+	release chan struct{}
+}
+
+func (s *stuckReader) Read() (ringbuf.Record, error) {
+	<-s.release
+	return ringbuf.Record{}, ringbuf.ErrClosed
+}
+
+func (s *stuckReader) Close() error {
+	<-s.release
+	return nil
+}
+
+func TestEventReaderCloseTimeout(t *testing.T) {
+	orig := eventReaderCloseTimeout
+	t.Cleanup(func() { eventReaderCloseTimeout = orig })
+	eventReaderCloseTimeout = 20 * time.Millisecond
+
+	rd := &stuckReader{release: make(chan struct{})}
+	defer close(rd.release)
+	r := startEventReader(rd, 1)
+	if err := r.Close(); err == nil || !strings.Contains(err.Error(), "did not stop") {
+		t.Fatalf("Close() = %v, want a timeout error", err)
+	}
+}
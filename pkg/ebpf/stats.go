@@ -0,0 +1,48 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// StatsEnabledPath is the sysctl controlling per-program run-time statistics
+const StatsEnabledPath = "/proc/sys/kernel/bpf_stats_enabled"
+
+// StatsEnabled reports whether bpf_stats_enabled is set in the sysctl at path
+func StatsEnabled(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	switch v := strings.TrimSpace(string(data)); v {
+	case "0":
+		return false, nil
+	case "1":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unexpected value %q in %s", v, path)
+	}
+}
+
+// enableStats turns on run-time statistics for the lifetime of the returned closer.
+// Permission errors are logged and reported as a nil closer so loading can continue.
+func enableStats() (io.Closer, error) {
+	closer, err := ebpf.EnableStats(uint32(unix.BPF_STATS_RUN_TIME))
+	if err != nil {
+		if errors.Is(err, fs.ErrPermission) || errors.Is(err, unix.EPERM) {
+			log.Printf("Not permitted to enable bpf stats, continuing without: %v", err)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("enable stats: %w", err)
+	}
+	return closer, nil
+}
@@ -0,0 +1,118 @@
+package ebpf
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Reloader is a component that can be health-checked and reloaded in place
+type Reloader interface {
+	Ping() error
+	Reload() error
+}
+
+// SupervisorConfig holds the retry policy for the supervisor
+type SupervisorConfig struct {
+	// Interval between health pings
+	Interval time.Duration
+	// MaxReloads is the number of reloads attempted per failure before giving up
+	MaxReloads int
+	// Backoff is the pause between consecutive reload attempts
+	Backoff time.Duration
+	// OnGiveUp is called once when reloads can't restore a healthy state,
+	// typically to let liveness fail
+	OnGiveUp func(error)
+	// OnReload is called after every successful reload, once the new maps
+	// are in place, e.g. to reset collector baselines
+	OnReload func()
+}
+
+// Supervisor pings a Reloader and attempts bounded in-process recovery
+type Supervisor struct {
+	target   Reloader
+	cfg      SupervisorConfig
+	stopChan chan struct{}
+	done     chan struct{}
+}
+
+// NewSupervisor creates a supervisor for target
+func NewSupervisor(target Reloader, cfg SupervisorConfig) *Supervisor {
+	if cfg.Interval == 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.MaxReloads <= 0 {
+		cfg.MaxReloads = 3
+	}
+	return &Supervisor{
+		target:   target,
+		cfg:      cfg,
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start begins supervising in the background
+func (s *Supervisor) Start() {
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.check(); err != nil {
+					log.Printf("eBPF supervisor giving up: %v", err)
+					if s.cfg.OnGiveUp != nil {
+						s.cfg.OnGiveUp(err)
+					}
+					return
+				}
+			case <-s.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops supervising and waits for the loop to exit
+func (s *Supervisor) Stop() {
+	close(s.stopChan)
+	<-s.done
+}
+
+// check pings the target and reloads it on failure, returning an error only
+// when every permitted reload failed to restore a healthy state
+func (s *Supervisor) check() error {
+	pingErr := s.target.Ping()
+	if pingErr == nil {
+		return nil
+	}
+	log.Printf("eBPF health ping failed, attempting reload: %v", pingErr)
+
+	for attempt := 1; attempt <= s.cfg.MaxReloads; attempt++ {
+		err := s.target.Reload()
+		if err == nil {
+			if s.cfg.OnReload != nil {
+				s.cfg.OnReload()
+			}
+			err = s.target.Ping()
+		}
+		if err == nil {
+			log.Printf("eBPF subsystem recovered after %d reload(s)", attempt)
+			return nil
+		}
+		log.Printf("eBPF reload attempt %d/%d failed: %v", attempt, s.cfg.MaxReloads, err)
+
+		if attempt < s.cfg.MaxReloads {
+			select {
+			case <-time.After(s.cfg.Backoff):
+			case <-s.stopChan:
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%d reloads failed after ping error: %w", s.cfg.MaxReloads, pingErr)
+}
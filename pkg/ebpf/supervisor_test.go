@@ -0,0 +1,79 @@
+package ebpf
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeReloader fails pings until it has been reloaded healAfter times
+type fakeReloader struct {
+	healAfter int
+	reloads   int
+	reloadErr error
+}
+
+func (f *fakeReloader) Ping() error {
+	if f.reloads < f.healAfter {
+		return errors.New("link detached")
+	}
+	return nil
+}
+
+func (f *fakeReloader) Reload() error {
+	if f.reloadErr != nil {
+		return f.reloadErr
+	}
+	f.reloads++
+	return nil
+}
+
+func TestSupervisorCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      *fakeReloader
+		wantErr     bool
+		wantReloads int
+	}{
+		{name: "healthy", target: &fakeReloader{}},
+		{name: "recovers", target: &fakeReloader{healAfter: 2}, wantReloads: 2},
+		{name: "gives up", target: &fakeReloader{healAfter: 5}, wantErr: true, wantReloads: 3},
+		{name: "reload fails", target: &fakeReloader{healAfter: 1, reloadErr: errors.New("load failed")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSupervisor(tt.target, SupervisorConfig{MaxReloads: 3})
+			err := s.check()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("check() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.target.reloads != tt.wantReloads {
+				t.Errorf("reloads = %d, want %d", tt.target.reloads, tt.wantReloads)
+			}
+		})
+	}
+}
+
+func TestSupervisorOnReload(t *testing.T) {
+	calls := 0
+	target := &fakeReloader{healAfter: 1}
+	s := NewSupervisor(target, SupervisorConfig{OnReload: func() {
+		calls++
+		if target.reloads != 1 {
+			t.Errorf("OnReload ran before the reload completed")
+		}
+	}})
+	if err := s.check(); err != nil {
+		t.Fatalf("check() = %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("OnReload called %d times, want once per successful reload", calls)
+	}
+
+	calls = 0
+	failing := &fakeReloader{healAfter: 1, reloadErr: errors.New("load failed")}
+	s = NewSupervisor(failing, SupervisorConfig{MaxReloads: 2, OnReload: func() { calls++ }})
+	_ = s.check()
+	if calls != 0 {
+		t.Fatalf("OnReload called %d times after failed reloads, want 0", calls)
+	}
+}
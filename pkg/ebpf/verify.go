@@ -0,0 +1,97 @@
+package ebpf
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/cilium/ebpf"
+)
+
+// verifyPollInterval is how often VerifyActive checks the counts map
+const verifyPollInterval = 100 * time.Millisecond
+
+// selfConnect is called once by VerifyActive to make the probe fire;
+// replaceable for tests
+var selfConnect = loopbackConnect
+
+// VerifyActive checks that the attached program actually fires by waiting up
+// to timeout for an entry to appear in the counts map. It first makes a
+// loopback TCP connection so a tcp_connect probe has something to observe.
+func (m *Manager) VerifyActive(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	triggered := false
+	for {
+		countsMap := m.GetCountsMap()
+		if countsMap == nil {
+			return fmt.Errorf("manager is closed")
+		}
+		ok, err := hasEntries(countsMap)
+		if err != nil {
+			return fmt.Errorf("read counts map: %w", err)
+		}
+		if ok {
+			return nil
+		}
+
+		if !triggered {
+			triggered = true
+			// Best effort: the probe may still fire on other traffic
+			_ = selfConnect()
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no entries in map %q within %s: probe did not fire", m.cfg.MapName, timeout)
+		}
+		time.Sleep(verifyPollInterval)
+	}
+}
+
+// hasEntries reports whether the map holds at least one key, or for array
+// maps, which always hold every key, at least one non-zero value
+func hasEntries(m *ebpf.Map) (bool, error) {
+	switch m.Type() {
+	case ebpf.Array, ebpf.PerCPUArray:
+		return hasNonZeroValue(m)
+	}
+
+	// A nil interface key returns the first key
+	var key interface{}
+	next, err := m.NextKeyBytes(key)
+	if err != nil {
+		return false, err
+	}
+	return next != nil, nil
+}
+
+// hasNonZeroValue reports whether any element of an array map is non-zero.
+// Per-CPU values are read for every CPU at once.
+func hasNonZeroValue(m *ebpf.Map) (bool, error) {
+	for i := uint32(0); i < m.MaxEntries(); i++ {
+		value, err := m.LookupBytes(i)
+		if err != nil {
+			return false, err
+		}
+		for _, b := range value {
+			if b != 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// loopbackConnect opens and closes a TCP connection to a local listener
+func loopbackConnect() error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	conn, err := net.DialTimeout("tcp", ln.Addr().String(), time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
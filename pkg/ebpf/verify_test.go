@@ -0,0 +1,73 @@
+package ebpf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+)
+
+// newTestMap creates a map for the test, skipping it where BPF maps can't be
+// created (e.g. without CAP_BPF)
+func newTestMap(t *testing.T, spec *ebpf.MapSpec) *ebpf.Map {
+	t.Helper()
+	m, err := ebpf.NewMap(spec)
+	if err != nil {
+		t.Skipf("creating BPF map: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestHasEntries(t *testing.T) {
+	for _, typ := range []ebpf.MapType{ebpf.Hash, ebpf.Array, ebpf.PerCPUArray} {
+		t.Run(typ.String(), func(t *testing.T) {
+			m := newTestMap(t, &ebpf.MapSpec{Type: typ, KeySize: 4, ValueSize: 8, MaxEntries: 4})
+
+			ok, err := hasEntries(m)
+			if err != nil {
+				t.Fatalf("hasEntries: %v", err)
+			}
+			if ok {
+				t.Error("hasEntries reported entries in an untouched map")
+			}
+
+			value := any(uint64(1))
+			if typ == ebpf.PerCPUArray {
+				possible, err := ebpf.PossibleCPU()
+				if err != nil {
+					t.Fatal(err)
+				}
+				values := make([]uint64, possible)
+				values[possible-1] = 1
+				value = values
+			}
+			if err := m.Put(uint32(2), value); err != nil {
+				t.Fatalf("put: %v", err)
+			}
+			if ok, err := hasEntries(m); err != nil || !ok {
+				t.Errorf("hasEntries after a write = %v, %v, want true", ok, err)
+			}
+		})
+	}
+}
+
+func TestVerifyActiveArrayMap(t *testing.T) {
+	m := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Array, KeySize: 4, ValueSize: 8, MaxEntries: 4})
+	mgr := &Manager{cfg: Config{MapName: "counts"}}
+	mgr.countsMap.Store(m)
+
+	// The probe never fires: every slot stays zero
+	orig := selfConnect
+	t.Cleanup(func() { selfConnect = orig })
+	selfConnect = func() error { return nil }
+	if err := mgr.VerifyActive(0); err == nil {
+		t.Error("VerifyActive passed on an all-zero array map")
+	}
+
+	// The probe fires on the loopback connection
+	selfConnect = func() error { return m.Put(uint32(0), uint64(1)) }
+	if err := mgr.VerifyActive(time.Second); err != nil {
+		t.Errorf("VerifyActive: %v", err)
+	}
+}
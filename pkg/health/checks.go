@@ -0,0 +1,83 @@
+package health
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// CheckFunc is a readiness sub-check; it returns nil when healthy
+type CheckFunc func() error
+
+// namedCheck is a registered readiness sub-check
+type namedCheck struct {
+	name  string
+	check CheckFunc
+}
+
+// checks holds the registered readiness sub-checks
+type checks struct {
+	mu   sync.RWMutex
+	list []namedCheck
+}
+
+// AddReadinessCheck registers a sub-check that must pass for the
+// application to be reported ready
+func (c *Checker) AddReadinessCheck(name string, check CheckFunc) {
+	c.checks.mu.Lock()
+	defer c.checks.mu.Unlock()
+	c.checks.list = append(c.checks.list, namedCheck{name: name, check: check})
+}
+
+// CheckStatus is the result of a single readiness sub-check
+type CheckStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// runChecks runs every sub-check and reports each result
+func (c *Checker) runChecks() []CheckStatus {
+	c.checks.mu.RLock()
+	defer c.checks.mu.RUnlock()
+	statuses := make([]CheckStatus, 0, len(c.checks.list))
+	for _, nc := range c.checks.list {
+		st := CheckStatus{Name: nc.name, Healthy: true}
+		if err := nc.check(); err != nil {
+			st.Healthy = false
+			st.Error = err.Error()
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// readinessError runs the sub-checks and returns the first failure
+func (c *Checker) readinessError() error {
+	c.checks.mu.RLock()
+	defer c.checks.mu.RUnlock()
+	for _, nc := range c.checks.list {
+		if err := nc.check(); err != nil {
+			return fmt.Errorf("%s: %w", nc.name, err)
+		}
+	}
+	return nil
+}
+
+// statfs is unix.Statfs, replaceable for tests
+var statfs = unix.Statfs
+
+// NewBPFFSCheck returns a check that verifies path is on a mounted bpf filesystem
+func NewBPFFSCheck(path string) CheckFunc {
+	return func() error {
+		var st unix.Statfs_t
+		if err := statfs(path, &st); err != nil {
+			return fmt.Errorf("statfs %s: %w", path, err)
+		}
+		if uint32(st.Type) != unix.BPF_FS_MAGIC {
+			return fmt.Errorf("%s is not a bpf filesystem (type %#x)", path, st.Type)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// fakeStatfs makes statfs report fsType, or fail with err
+func fakeStatfs(t *testing.T, fsType int64, err error) {
+	t.Helper()
+	orig := statfs
+	statfs = func(path string, st *unix.Statfs_t) error {
+		if err != nil {
+			return err
+		}
+		st.Type = fsType
+		return nil
+	}
+	t.Cleanup(func() { statfs = orig })
+}
+
+func TestBPFFSCheck(t *testing.T) {
+	check := NewBPFFSCheck("/sys/fs/bpf")
+
+	fakeStatfs(t, unix.BPF_FS_MAGIC, nil)
+	if err := check(); err != nil {
+		t.Fatalf("bpf filesystem: %v", err)
+	}
+
+	fakeStatfs(t, unix.TMPFS_MAGIC, nil)
+	if err := check(); err == nil || !strings.Contains(err.Error(), "not a bpf filesystem") {
+		t.Fatalf("tmpfs: got %v, want not a bpf filesystem", err)
+	}
+
+	fakeStatfs(t, 0, unix.ENOENT)
+	if err := check(); !errors.Is(err, unix.ENOENT) {
+		t.Fatalf("missing mount: got %v, want ENOENT", err)
+	}
+}
+
+func TestReadinessCheckFailsIsReady(t *testing.T) {
+	c := NewChecker()
+	c.SetReady(true)
+	fakeStatfs(t, unix.TMPFS_MAGIC, nil)
+	c.AddReadinessCheck("bpffs", NewBPFFSCheck("/sys/fs/bpf"))
+
+	if c.IsReady() {
+		t.Fatal("IsReady() = true while bpffs isn't mounted")
+	}
+	if err := c.readinessError(); err == nil || !strings.HasPrefix(err.Error(), "bpffs: ") {
+		t.Fatalf("readinessError() = %v, want it to name the check", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	c := NewChecker()
+	c.SetReady(true)
+	c.SetStarted(true)
+	c.AddReadinessCheck("map", func() error { return nil })
+	c.AddReadinessCheck("bpffs", func() error { return errors.New("not mounted") })
+
+	got := c.Snapshot()
+	if got.Ready {
+		t.Error("Ready = true with a failing sub-check")
+	}
+	if !got.Started || got.Timestamp == 0 {
+		t.Errorf("Started = %v, Timestamp = %d", got.Started, got.Timestamp)
+	}
+	want := []CheckStatus{{Name: "map", Healthy: true}, {Name: "bpffs", Error: "not mounted"}}
+	if len(got.Checks) != len(want) {
+		t.Fatalf("Checks = %+v, want %+v", got.Checks, want)
+	}
+	for i := range want {
+		if got.Checks[i] != want[i] {
+			t.Errorf("Checks[%d] = %+v, want %+v", i, got.Checks[i], want[i])
+		}
+	}
+}
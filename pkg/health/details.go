@@ -0,0 +1,49 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// DetailsProvider reports diagnostic details about a subsystem, such as the eBPF manager
+type DetailsProvider interface {
+	Details() (any, error)
+}
+
+// DetailsFunc adapts a function to DetailsProvider
+type DetailsFunc func() (any, error)
+
+// Details implements DetailsProvider
+func (f DetailsFunc) Details() (any, error) {
+	return f()
+}
+
+// SetDetailsProvider sets the provider queried by DetailsHandler
+func (c *Checker) SetDetailsProvider(p DetailsProvider) {
+	c.details.Store(&p)
+}
+
+// DetailsHandler serves the subsystem details in JSON format.
+// It is separate from HealthHandler so probe responses stay unchanged.
+func (c *Checker) DetailsHandler(w http.ResponseWriter, r *http.Request) {
+	p := c.details.Load()
+	if p == nil {
+		http.Error(w, "no details provider configured", http.StatusNotFound)
+		return
+	}
+
+	details, err := (*p).Details()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Marshal first so an encoding error can still be reported with a status
+	body, err := json.Marshal(details)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writeBody(w, r, http.StatusOK, append(body, '\n'))
+}
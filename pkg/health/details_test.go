@@ -0,0 +1,40 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDetailsHandler(t *testing.T) {
+	c := NewChecker()
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c.DetailsHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/ebpf", nil))
+		return rec
+	}
+
+	if code := serve().Code; code != http.StatusNotFound {
+		t.Fatalf("without a provider got %d, want 404", code)
+	}
+
+	c.SetDetailsProvider(DetailsFunc(func() (any, error) {
+		return map[string]int{"programs": 1}, nil
+	}))
+	rec := serve()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got %d with Content-Type %q, want 200 JSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"programs":1}` {
+		t.Fatalf("body = %q", body)
+	}
+
+	c.SetDetailsProvider(DetailsFunc(func() (any, error) {
+		return nil, errors.New("manager closed")
+	}))
+	if rec := serve(); rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "manager closed") {
+		t.Fatalf("failing provider got %d %q, want 500 with the error", rec.Code, rec.Body.String())
+	}
+}
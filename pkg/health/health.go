@@ -1,7 +1,9 @@
 package health
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"sync/atomic"
 	"time"
@@ -11,6 +13,17 @@ import (
 type Checker struct {
 	ready int64 // 0 = not ready, 1 = ready
 	alive int64 // 0 = not alive, 1 = alive
+
+	started int64 // 0 = no collection yet, 1 = first collection completed
+
+	effective int64 // readiness including sub-checks as last evaluated, mirrored to the readiness file
+
+	readySince int64 // unix nanoseconds when combined readiness last became true, 0 when not ready
+	now        func() time.Time
+
+	details  atomic.Pointer[DetailsProvider]
+	checks   checks
+	sentinel sentinel
 }
 
 // Status represents the health status
@@ -20,11 +33,21 @@ type Status struct {
 	Timestamp int64 `json:"timestamp"`
 }
 
+// DetailedStatus is the full health state including readiness sub-checks
+type DetailedStatus struct {
+	Ready     bool          `json:"ready"`
+	Alive     bool          `json:"alive"`
+	Started   bool          `json:"started"`
+	Timestamp int64         `json:"timestamp"`
+	Checks    []CheckStatus `json:"checks,omitempty"`
+}
+
 // NewChecker creates a new health checker
 func NewChecker() *Checker {
 	return &Checker{
 		alive: 1, // Alive from the start
 		ready: 0, // Not ready until initialized
+		now:   time.Now,
 	}
 }
 
@@ -35,6 +58,23 @@ func (c *Checker) SetReady(ready bool) {
 	} else {
 		atomic.StoreInt64(&c.ready, 0)
 	}
+	// Publish the combined readiness now, so the readiness file and
+	// ReadySince follow the flag without waiting for the next probe. The
+	// sub-checks only run when the flag is set.
+	c.observeReady(ready && c.readinessError() == nil)
+}
+
+// ReadySince returns when the application last became ready including its
+// sub-checks, or the zero time if it is not ready
+func (c *Checker) ReadySince() time.Time {
+	if !c.IsReady() {
+		return time.Time{}
+	}
+	ns := atomic.LoadInt64(&c.readySince)
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
 }
 
 // SetAlive marks the application as alive
@@ -46,9 +86,60 @@ func (c *Checker) SetAlive(alive bool) {
 	}
 }
 
-// IsReady returns whether the application is ready
+// SetStarted records whether the first successful metrics collection has completed
+func (c *Checker) SetStarted(started bool) {
+	if started {
+		atomic.StoreInt64(&c.started, 1)
+	} else {
+		atomic.StoreInt64(&c.started, 0)
+	}
+}
+
+// IsStarted returns whether the first successful metrics collection has completed
+func (c *Checker) IsStarted() bool {
+	return atomic.LoadInt64(&c.started) == 1
+}
+
+// IsReady returns whether the application is ready and all readiness sub-checks pass
 func (c *Checker) IsReady() bool {
-	return atomic.LoadInt64(&c.ready) == 1
+	return c.observeReady(atomic.LoadInt64(&c.ready) == 1 && c.readinessError() == nil)
+}
+
+// observeReady records an evaluation of the combined readiness, updating
+// readySince and the readiness file when it changed, and returns ready
+func (c *Checker) observeReady(ready bool) bool {
+	var v int64
+	if ready {
+		v = 1
+	}
+	if atomic.SwapInt64(&c.effective, v) != v {
+		var since int64
+		if ready {
+			now := c.now
+			if now == nil {
+				now = time.Now
+			}
+			since = now().UnixNano()
+		}
+		atomic.StoreInt64(&c.readySince, since)
+		c.syncReadinessFile()
+	}
+	return ready
+}
+
+// WatchReadiness evaluates readiness every interval until ctx is done, so the
+// readiness file follows the sub-checks even when nothing probes over HTTP
+func (c *Checker) WatchReadiness(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.IsReady()
+		}
+	}
 }
 
 // IsAlive returns whether the application is alive
@@ -65,15 +156,30 @@ func (c *Checker) GetStatus() Status {
 	}
 }
 
+// Snapshot returns the full health state, running each sub-check once
+func (c *Checker) Snapshot() DetailedStatus {
+	checks := c.runChecks()
+	ready := atomic.LoadInt64(&c.ready) == 1
+	for _, st := range checks {
+		ready = ready && st.Healthy
+	}
+	c.observeReady(ready)
+	return DetailedStatus{
+		Ready:     ready,
+		Alive:     c.IsAlive(),
+		Started:   c.IsStarted(),
+		Timestamp: time.Now().Unix(),
+		Checks:    checks,
+	}
+}
+
 // LivenessHandler handles Kubernetes liveness probes
 // This checks if the application is running and not deadlocked
 func (c *Checker) LivenessHandler(w http.ResponseWriter, r *http.Request) {
 	if c.IsAlive() {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("OK"))
+		writeBody(w, r, http.StatusOK, []byte("OK"))
 	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		_, _ = w.Write([]byte("Not alive"))
+		writeBody(w, r, http.StatusServiceUnavailable, []byte("Not alive"))
 	}
 }
 
@@ -81,24 +187,57 @@ func (c *Checker) LivenessHandler(w http.ResponseWriter, r *http.Request) {
 // This checks if the application is ready to serve traffic
 func (c *Checker) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
 	if c.IsReady() {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("Ready"))
+		writeBody(w, r, http.StatusOK, []byte("Ready"))
 	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		_, _ = w.Write([]byte("Not ready"))
+		writeBody(w, r, http.StatusServiceUnavailable, []byte("Not ready"))
 	}
 }
 
-// HealthHandler provides detailed health information in JSON format
+// HealthHandler serves the Snapshot as JSON. Pass ?pretty=1 for indented output.
 func (c *Checker) HealthHandler(w http.ResponseWriter, r *http.Request) {
-	status := c.GetStatus()
+	status := c.Snapshot()
 
-	if status.Ready && status.Alive {
-		w.WriteHeader(http.StatusOK)
+	var body []byte
+	var err error
+	if wantPretty(r) {
+		body, err = json.MarshalIndent(status, "", "  ")
 	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
+		body, err = json.Marshal(status)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
+	// Headers must be set before WriteHeader for them to be sent
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(status)
+	code := http.StatusOK
+	if !status.Ready || !status.Alive {
+		code = http.StatusServiceUnavailable
+	}
+	writeBody(w, r, code, append(body, '\n'))
+}
+
+// logWriteError records a failed response write; replaceable for tests
+var logWriteError = func(r *http.Request, err error) {
+	slog.Debug("Failed to write health response", "path", r.URL.Path, "error", err)
+}
+
+// writeBody writes the status code once followed by body, logging write
+// failures such as a probe client disconnecting mid-response
+func writeBody(w http.ResponseWriter, r *http.Request, code int, body []byte) {
+	w.WriteHeader(code)
+	if _, err := w.Write(body); err != nil {
+		logWriteError(r, err)
+	}
+}
+
+// wantPretty reports whether the request asked for indented JSON
+func wantPretty(r *http.Request) bool {
+	switch r.URL.Query().Get("pretty") {
+	case "1", "true", "yes":
+		return true
+	default:
+		return false
+	}
 }
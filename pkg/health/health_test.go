@@ -0,0 +1,185 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fileExists reports whether path exists
+func fileExists(t *testing.T, path string) bool {
+	t.Helper()
+	_, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("stat %s: %v", path, err)
+	}
+	return err == nil
+}
+
+func TestReadinessFileFollowsChecks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ready")
+	c := NewChecker()
+	var failing atomic.Bool
+	c.AddReadinessCheck("test", func() error {
+		if failing.Load() {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	if err := c.SetReadinessFile(path); err != nil {
+		t.Fatalf("SetReadinessFile: %v", err)
+	}
+
+	failing.Store(true)
+	c.SetReady(true)
+	if fileExists(t, path) {
+		t.Fatal("readiness file created while a readiness check fails")
+	}
+
+	failing.Store(false)
+	if !c.IsReady() {
+		t.Fatal("IsReady() = false with passing checks")
+	}
+	if !fileExists(t, path) {
+		t.Fatal("readiness file missing after checks started passing")
+	}
+
+	failing.Store(true)
+	if c.Snapshot().Ready {
+		t.Fatal("Snapshot().Ready = true with a failing check")
+	}
+	if fileExists(t, path) {
+		t.Fatal("readiness file left behind after a check started failing")
+	}
+
+	failing.Store(false)
+	c.IsReady()
+	c.SetReady(false)
+	if fileExists(t, path) {
+		t.Fatal("readiness file left behind after SetReady(false)")
+	}
+}
+
+func TestReadySinceFollowsChecks(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := NewChecker()
+	c.now = func() time.Time { return now }
+	var failing atomic.Bool
+	failing.Store(true)
+	c.AddReadinessCheck("test", func() error {
+		if failing.Load() {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+
+	c.SetReady(true)
+	if got := c.ReadySince(); !got.IsZero() {
+		t.Fatalf("ReadySince() = %v with a failing check, want zero", got)
+	}
+
+	now = now.Add(time.Minute)
+	failing.Store(false)
+	if got := c.ReadySince(); !got.Equal(now) {
+		t.Fatalf("ReadySince() = %v, want %v when the check started passing", got, now)
+	}
+
+	failing.Store(true)
+	if got := c.ReadySince(); !got.IsZero() {
+		t.Fatalf("ReadySince() = %v after a check started failing, want zero", got)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	c := NewChecker()
+	c.SetReady(true)
+	c.AddReadinessCheck("bpffs", func() error { return errors.New("not mounted") })
+
+	for _, tt := range []struct {
+		query  string
+		pretty bool
+	}{{"", false}, {"?pretty=1", true}, {"?pretty=no", false}} {
+		rec := httptest.NewRecorder()
+		c.HealthHandler(rec, httptest.NewRequest(http.MethodGet, "/health"+tt.query, nil))
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%q: got %d with a failing check, want 503", tt.query, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%q: Content-Type = %q, want application/json", tt.query, ct)
+		}
+		if got := strings.Contains(rec.Body.String(), "\n  "); got != tt.pretty {
+			t.Errorf("%q: indented = %v, want %v:\n%s", tt.query, got, tt.pretty, rec.Body)
+		}
+		var status DetailedStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%q: decode: %v", tt.query, err)
+		}
+		if status.Ready || len(status.Checks) != 1 || status.Checks[0].Error != "not mounted" {
+			t.Errorf("%q: status = %+v", tt.query, status)
+		}
+	}
+}
+
+// failingWriter is a ResponseWriter whose body writes fail, like a probe
+// client that disconnected
+type failingWriter struct {
+	httptest.ResponseRecorder
+}
+
+func (w *failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestWriteErrorsLogged(t *testing.T) {
+	var logged []string
+	orig := logWriteError
+	logWriteError = func(r *http.Request, err error) {
+		logged = append(logged, r.URL.Path+": "+err.Error())
+	}
+	t.Cleanup(func() { logWriteError = orig })
+
+	c := NewChecker()
+	for path, h := range map[string]http.HandlerFunc{
+		"/liveness":  c.LivenessHandler,
+		"/readiness": c.ReadinessHandler,
+		"/health":    c.HealthHandler,
+	} {
+		w := &failingWriter{ResponseRecorder: *httptest.NewRecorder()}
+		h(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code == 0 {
+			t.Errorf("%s: no status written", path)
+		}
+	}
+	if len(logged) != 3 {
+		t.Fatalf("logged %v, want one write error per handler", logged)
+	}
+}
+
+func TestSetReadyFalseSkipsChecks(t *testing.T) {
+	c := NewChecker()
+	var runs atomic.Int32
+	c.AddReadinessCheck("test", func() error {
+		runs.Add(1)
+		return nil
+	})
+
+	c.SetReady(false)
+	if runs.Load() != 0 {
+		t.Errorf("SetReady(false) ran the readiness checks %d times", runs.Load())
+	}
+	c.SetReady(true)
+	if runs.Load() != 1 {
+		t.Errorf("SetReady(true) ran the readiness checks %d times, want once", runs.Load())
+	}
+	if got := c.ReadySince(); got.IsZero() {
+		t.Error("ReadySince() is zero right after SetReady(true) with passing checks")
+	}
+}
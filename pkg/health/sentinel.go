@@ -0,0 +1,73 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// sentinel mirrors readiness to a file for orchestration that checks the
+// filesystem instead of HTTP probes
+type sentinel struct {
+	mu   sync.Mutex
+	path string
+}
+
+// SetReadinessFile makes the checker create path while ready and remove it
+// otherwise. The file is written under a temporary name and renamed, so
+// readers never see it partially written. An empty path disables the file.
+func (c *Checker) SetReadinessFile(path string) error {
+	c.sentinel.mu.Lock()
+	defer c.sentinel.mu.Unlock()
+
+	c.sentinel.path = path
+	return c.syncReadinessFileLocked()
+}
+
+// syncReadinessFile updates the readiness file after readiness changed, logging failures
+func (c *Checker) syncReadinessFile() {
+	c.sentinel.mu.Lock()
+	defer c.sentinel.mu.Unlock()
+
+	if err := c.syncReadinessFileLocked(); err != nil {
+		slog.Warn("Failed to update readiness file", "path", c.sentinel.path, "error", err)
+	}
+}
+
+// syncReadinessFileLocked writes or removes the file for the current
+// combined readiness, so concurrent flips always settle on the latest state
+func (c *Checker) syncReadinessFileLocked() error {
+	path := c.sentinel.path
+	if path == "" {
+		return nil
+	}
+
+	if atomic.LoadInt64(&c.effective) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove readiness file: %w", err)
+		}
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("write readiness file: %w", err)
+	}
+	_, err = tmp.WriteString("ready\n")
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write readiness file: %w", err)
+	}
+	return nil
+}
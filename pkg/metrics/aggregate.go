@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"sort"
+	"strconv"
+)
+
+// aggregateByTGID merges entries whose PIDs belong to the same thread group,
+// summing their counters under the TGID. Entries whose TGID can't be read
+// (e.g. the task already exited) are kept under their own PID.
+// timestampField, if set, is merged as the latest time rather than summed.
+func aggregateByTGID(entries []MapEntry, getTGID func(pid int) (int, error), timestampField string) []MapEntry {
+	type groupKey struct {
+		pid       uint32
+		direction string
+		dport     uint16
+		family    string
+	}
+
+	merged := make(map[groupKey]*MapEntry, len(entries))
+	for _, e := range entries {
+		if tgid, err := getTGID(int(e.PID)); err == nil {
+			e.PID = uint32(tgid)
+		}
+
+		key := groupKey{e.PID, e.Direction, e.Dport, e.Family}
+		dst, ok := merged[key]
+		if !ok {
+			merged[key] = cloneEntry(e)
+			continue
+		}
+		mergeEntry(dst, e, timestampField)
+	}
+
+	out := make([]MapEntry, 0, len(merged))
+	for _, e := range merged {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].PID != out[j].PID {
+			return out[i].PID < out[j].PID
+		}
+		if out[i].Direction != out[j].Direction {
+			return out[i].Direction < out[j].Direction
+		}
+		if out[i].Dport != out[j].Dport {
+			return out[i].Dport < out[j].Dport
+		}
+		return out[i].Family < out[j].Family
+	})
+	return out
+}
+
+// aggregateByPort merges entries across PIDs, summing their counters per
+// destination port, direction and family
+func aggregateByPort(entries []MapEntry, timestampField string) []MapEntry {
+	type groupKey struct {
+		dport     uint16
+		direction string
+		family    string
+	}
+
+	merged := make(map[groupKey]*MapEntry, len(entries))
+	for _, e := range entries {
+		e.PID = 0
+		key := groupKey{e.Dport, e.Direction, e.Family}
+		dst, ok := merged[key]
+		if !ok {
+			merged[key] = cloneEntry(e)
+			continue
+		}
+		mergeEntry(dst, e, timestampField)
+	}
+
+	out := make([]MapEntry, 0, len(merged))
+	for _, e := range merged {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Dport != out[j].Dport {
+			return out[i].Dport < out[j].Dport
+		}
+		if out[i].Direction != out[j].Direction {
+			return out[i].Direction < out[j].Direction
+		}
+		return out[i].Family < out[j].Family
+	})
+	return out
+}
+
+// aggregatedPID is the pid label of series summing the PIDs beyond a comm's limit
+const aggregatedPID = "aggregated"
+
+// pidLabel returns the entry's pid label value
+func (e MapEntry) pidLabel() string {
+	if e.Aggregated {
+		return aggregatedPID
+	}
+	return strconv.FormatUint(uint64(e.PID), 10)
+}
+
+// sampleByComm keeps at most max PIDs per comm, preferring the highest
+// counts, and sums the rest of each comm into one entry marked Aggregated.
+// Entries also split by direction, dport or family are grouped per value.
+func sampleByComm(entries []MapEntry, max int, timestampField string) []MapEntry {
+	type groupKey struct {
+		comm      string
+		direction string
+		dport     uint16
+		family    string
+	}
+
+	groups := make(map[groupKey][]int)
+	for i, e := range entries {
+		key := groupKey{e.Comm, e.Direction, e.Dport, e.Family}
+		groups[key] = append(groups[key], i)
+	}
+
+	drop := make(map[int]bool)
+	var merged []MapEntry
+	for _, idx := range groups {
+		if len(idx) <= max {
+			continue
+		}
+		sort.SliceStable(idx, func(i, j int) bool {
+			return entries[idx[i]].Count > entries[idx[j]].Count
+		})
+
+		var sum *MapEntry
+		for _, i := range idx[max:] {
+			drop[i] = true
+			if sum == nil {
+				sum = cloneEntry(entries[i])
+				sum.PID = 0
+				sum.Aggregated = true
+				sum.PodUID, sum.ContainerID = "", ""
+				continue
+			}
+			mergeEntry(sum, entries[i], timestampField)
+		}
+		merged = append(merged, *sum)
+	}
+	if len(merged) == 0 {
+		return entries
+	}
+
+	out := make([]MapEntry, 0, len(entries)-len(drop)+len(merged))
+	for i, e := range entries {
+		if !drop[i] {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Comm < merged[j].Comm
+	})
+	return append(out, merged...)
+}
+
+// cloneEntry copies e so merging into it doesn't modify the original's Values
+func cloneEntry(e MapEntry) *MapEntry {
+	if e.Values != nil {
+		values := make(map[string]uint64, len(e.Values))
+		for k, v := range e.Values {
+			values[k] = v
+		}
+		e.Values = values
+	}
+	return &e
+}
+
+// mergeEntry adds src's counters into dst. The timestamp field, if any,
+// keeps the latest of the two times, since a sum of them means nothing.
+func mergeEntry(dst *MapEntry, src MapEntry, timestampField string) {
+	dst.Count += src.Count
+	for k, v := range src.Values {
+		if k == timestampField {
+			dst.Values[k] = max(dst.Values[k], v)
+			continue
+		}
+		dst.Values[k] += v
+	}
+	if src.TraceID != "" {
+		dst.TraceID = src.TraceID
+	}
+}
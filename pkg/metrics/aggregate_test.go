@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAggregateByTGID(t *testing.T) {
+	tgids := map[int]int{101: 100, 102: 100}
+	getTGID := func(pid int) (int, error) {
+		if tgid, ok := tgids[pid]; ok {
+			return tgid, nil
+		}
+		return 0, fmt.Errorf("no such task")
+	}
+	entries := []MapEntry{
+		{PID: 101, Count: 2, Values: map[string]uint64{"connects": 2, "last_ns": 500}},
+		{PID: 102, Count: 3, Values: map[string]uint64{"connects": 3, "last_ns": 900}},
+		{PID: 200, Count: 1, Values: map[string]uint64{"connects": 1, "last_ns": 100}},
+	}
+
+	got := aggregateByTGID(entries, getTGID, "last_ns")
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(got), got)
+	}
+	if got[0].PID != 100 || got[0].Count != 5 || got[0].Values["connects"] != 5 {
+		t.Errorf("thread group = %+v, want pid 100 counting 5", got[0])
+	}
+	if got[0].Values["last_ns"] != 900 {
+		t.Errorf("merged timestamp = %d, want the latest, 900", got[0].Values["last_ns"])
+	}
+	if got[1].PID != 200 {
+		t.Errorf("entry without a TGID moved to pid %d", got[1].PID)
+	}
+	if entries[0].Values["connects"] != 2 {
+		t.Error("merging modified the input entries")
+	}
+}
+
+func TestSampleByComm(t *testing.T) {
+	entries := []MapEntry{
+		{PID: 1, Comm: "worker", Count: 10, Values: map[string]uint64{"connects": 10, "last_ns": 30}},
+		{PID: 2, Comm: "worker", Count: 1, Values: map[string]uint64{"connects": 1, "last_ns": 70}},
+		{PID: 3, Comm: "worker", Count: 2, Values: map[string]uint64{"connects": 2, "last_ns": 50}},
+		{PID: 4, Comm: "nginx", Count: 4, Values: map[string]uint64{"connects": 4, "last_ns": 10}},
+	}
+
+	got := sampleByComm(entries, 1, "last_ns")
+	if len(got) != 3 {
+		t.Fatalf("got %d entries, want 3: %+v", len(got), got)
+	}
+	var sum MapEntry
+	for _, e := range got {
+		if e.Aggregated {
+			sum = e
+		} else if e.Comm == "worker" && e.PID != 1 {
+			t.Errorf("kept pid %d instead of the busiest worker", e.PID)
+		}
+	}
+	if sum.Comm != "worker" || sum.Count != 3 || sum.pidLabel() != aggregatedPID {
+		t.Errorf("aggregated entry = %+v, want worker counting 3", sum)
+	}
+	if sum.Values["last_ns"] != 70 {
+		t.Errorf("aggregated timestamp = %d, want the latest, 70", sum.Values["last_ns"])
+	}
+}
+
+func TestCollectorPortOnlyTimestamps(t *testing.T) {
+	m := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 8, ValueSize: 16})
+	portKey := func(pid uint32, port uint16) []byte {
+		key := pid32(pid)
+		key = binary.BigEndian.AppendUint16(key, port)
+		return append(key, 0, 0)
+	}
+	putEntry(t, m, portKey(1, 443), u64(2, uint64(200*time.Second)))
+	putEntry(t, m, portKey(2, 443), u64(3, uint64(100*time.Second)))
+	putEntry(t, m, portKey(2, 80), u64(1, uint64(50*time.Second)))
+
+	reg := prometheus.NewRegistry()
+	clock := newFakeClock(time.Unix(2_000_000_000, 0))
+	c, err := NewCollector(Config{
+		CountsMap:      m,
+		Registerer:     reg,
+		Clock:          clock,
+		DportKey:       true,
+		PortOnly:       true,
+		ValueDecoder:   NewStructDecoder("connects", "last_ns"),
+		TimestampField: "last_ns",
+		OldestEntryAge: true,
+	})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+
+	last := gather(t, reg, "last_connect_timestamp_seconds")
+	https := findMetric(last, map[string]string{"dport": "443"})
+	if https == nil {
+		t.Fatal("no last_connect_timestamp_seconds for port 443")
+	}
+	want := float64(c.bootTime.Add(200*time.Second).UnixNano()) / 1e9
+	if got := https.GetGauge().GetValue(); got != want {
+		t.Errorf("port 443 last connect = %v, want the latest PID's %v", got, want)
+	}
+
+	age := gather(t, reg, "ebpf_oldest_entry_age_seconds")
+	if age == nil {
+		t.Fatal("ebpf_oldest_entry_age_seconds not gathered")
+	}
+	wantAge := clock.Now().Sub(c.bootTime.Add(50 * time.Second)).Seconds()
+	if got := age.GetMetric()[0].GetGauge().GetValue(); got != wantAge {
+		t.Errorf("oldest entry age = %v, want %v", got, wantAge)
+	}
+}
+
+func TestCollectorAggregate(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newCountsMap(t, map[uint32]uint64{selfPID: 3, 999998: 4, 999999: 5})
+	c, err := NewCollector(Config{CountsMap: m, Registerer: reg, Aggregate: true})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+
+	if f := gather(t, reg, "tcp_connects_by_pid"); f != nil {
+		t.Errorf("Aggregate mode exported %d per-PID series", len(f.GetMetric()))
+	}
+	f := gather(t, reg, "tcp_connects_total")
+	if f == nil {
+		t.Fatal("tcp_connects_total not gathered")
+	}
+	if n := len(f.GetMetric()); n != 1 {
+		t.Fatalf("tcp_connects_total has %d series, want exactly one", n)
+	}
+	s := f.GetMetric()[0]
+	if len(s.GetLabel()) != 0 {
+		t.Errorf("tcp_connects_total labels = %v, want none", labels(s))
+	}
+	if got := s.GetCounter().GetValue(); got != 12 {
+		t.Errorf("tcp_connects_total = %v, want the sum 12", got)
+	}
+}
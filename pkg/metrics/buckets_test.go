@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// histogramBounds returns the bucket upper bounds of the histogram called name
+func histogramBounds(t *testing.T, reg *prometheus.Registry, name string) []float64 {
+	t.Helper()
+	f := gather(t, reg, name)
+	if f == nil {
+		t.Fatalf("%s not gathered", name)
+	}
+	var bounds []float64
+	for _, b := range f.GetMetric()[0].GetHistogram().GetBucket() {
+		bounds = append(bounds, b.GetUpperBound())
+	}
+	return bounds
+}
+
+func TestDurationBuckets(t *testing.T) {
+	custom := []float64{0.0001, 0.001, 0.01}
+	tests := []struct {
+		name    string
+		buckets []float64
+		want    []float64
+	}{
+		{"default", nil, prometheus.DefBuckets},
+		{"custom", custom, custom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			if _, err := NewCollector(Config{Registerer: reg, DurationBuckets: tt.buckets}); err != nil {
+				t.Fatalf("NewCollector: %v", err)
+			}
+			for _, name := range []string{"ebpf_map_read_duration_seconds", "ebpf_name_resolve_duration_seconds"} {
+				if got := histogramBounds(t, reg, name); !slices.Equal(got, tt.want) {
+					t.Errorf("%s buckets = %v, want %v", name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDurationBucketsRejected(t *testing.T) {
+	for name, buckets := range map[string][]float64{
+		"empty":        {},
+		"zero":         {0, 1},
+		"negative":     {-1, 1},
+		"unsorted":     {0.1, 0.01},
+		"not strictly": {0.1, 0.1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			if _, err := NewCollector(Config{Registerer: reg, DurationBuckets: buckets}); err == nil {
+				t.Errorf("NewCollector accepted buckets %v", buckets)
+			}
+			if families, _ := reg.Gather(); len(families) != 0 {
+				t.Errorf("rejected config registered %d metrics", len(families))
+			}
+		})
+	}
+}
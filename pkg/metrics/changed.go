@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// changedSample is a single per-PID series with one value per field
+type changedSample struct {
+	labelValues []string
+	values      []float64
+	// changed marks the fields whose value differs from the previous collection
+	changed []bool
+}
+
+// changedCollector exports per-PID gauges as const metrics, emitting each
+// series only when its value differs from the one read by the previous
+// collection. GaugeVec always exports every series, so it can't skip them.
+// Changes are computed once per collection rather than per gather, so the
+// snapshot file, pushes and every scraper see the same series.
+type changedCollector struct {
+	descs []*prometheus.Desc
+
+	mu       sync.Mutex
+	samples  []changedSample
+	previous map[string][]float64
+}
+
+// newChangedCollector creates a collector with one descriptor per field
+func newChangedCollector(descs []*prometheus.Desc) *changedCollector {
+	return &changedCollector{
+		descs:    descs,
+		previous: make(map[string][]float64),
+	}
+}
+
+// seriesKey identifies a series by its label values
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+// update replaces the collected samples, marking the fields that changed
+// since the previous collection. Series that left the map are forgotten,
+// so they are emitted again if they return.
+func (c *changedCollector) update(samples []changedSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous := make(map[string][]float64, len(samples))
+	for i := range samples {
+		s := &samples[i]
+		key := seriesKey(s.labelValues)
+		prev := c.previous[key]
+		s.changed = make([]bool, len(s.values))
+		for j, v := range s.values {
+			s.changed[j] = prev == nil || prev[j] != v
+		}
+		previous[key] = s.values
+	}
+	c.previous = previous
+	c.samples = samples
+}
+
+// reset forgets the previous values, so the next collection emits every
+// series, e.g. after the map was swapped
+func (c *changedCollector) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.previous = make(map[string][]float64)
+}
+
+// Describe implements prometheus.Collector
+func (c *changedCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.descs {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *changedCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.samples {
+		for i, desc := range c.descs {
+			if !s.changed[i] {
+				continue
+			}
+			m, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, s.values[i], s.labelValues...)
+			if err != nil {
+				ch <- prometheus.NewInvalidMetric(desc, err)
+				continue
+			}
+			ch <- m
+		}
+	}
+}
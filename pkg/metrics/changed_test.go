@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gatheredPIDs returns the pid labels of the tcp_connects_by_pid series
+func gatheredPIDs(t *testing.T, g prometheus.Gatherer) map[string]bool {
+	t.Helper()
+	pids := make(map[string]bool)
+	if f := gather(t, g, "tcp_connects_by_pid"); f != nil {
+		for _, m := range f.GetMetric() {
+			pids[labels(m)["pid"]] = true
+		}
+	}
+	return pids
+}
+
+func TestEmitOnlyChanged(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newCountsMap(t, map[uint32]uint64{1: 1, 2: 1})
+	c, err := NewCollector(Config{CountsMap: m, Registerer: reg, EmitOnlyChanged: true})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	collect := func() {
+		t.Helper()
+		if _, err := c.CollectNow(); err != nil {
+			t.Fatalf("CollectNow: %v", err)
+		}
+	}
+
+	collect()
+	if pids := gatheredPIDs(t, reg); !pids["1"] || !pids["2"] {
+		t.Fatalf("first collection emitted %v, want every series", pids)
+	}
+	// Another gather, e.g. the snapshot file or a pusher, doesn't consume them
+	if pids := gatheredPIDs(t, reg); !pids["1"] || !pids["2"] {
+		t.Errorf("second gather of the same collection emitted %v, want every series", pids)
+	}
+
+	putEntry(t, m, pid32(2), u64(5))
+	collect()
+	if pids := gatheredPIDs(t, reg); pids["1"] || !pids["2"] {
+		t.Errorf("after pid 2 changed emitted %v, want only pid 2", pids)
+	}
+
+	collect()
+	if pids := gatheredPIDs(t, reg); len(pids) != 0 {
+		t.Errorf("unchanged collection emitted %v, want nothing", pids)
+	}
+
+	c.OnMapSwap()
+	collect()
+	if pids := gatheredPIDs(t, reg); !pids["1"] || !pids["2"] {
+		t.Errorf("collection after a map swap emitted %v, want every series", pids)
+	}
+}
+
+func TestEmitOnlyChangedRejectsExemplars(t *testing.T) {
+	_, err := NewCollector(Config{Registerer: prometheus.NewRegistry(), EmitOnlyChanged: true, ExemplarLabel: "trace_id"})
+	if err == nil {
+		t.Error("NewCollector accepted EmitOnlyChanged with ExemplarLabel")
+	}
+}
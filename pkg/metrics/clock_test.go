@@ -0,0 +1,241 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeClock is a manually advanced Clock driving the collection loop in tests
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// newFakeClock creates a fake clock starting at now
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+// Now returns the fake current time
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// NewTicker creates a ticker that fires as the clock is advanced
+func (f *fakeClock) NewTicker(d time.Duration) Ticker {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTicker{
+		clock:  f,
+		period: d,
+		next:   f.now.Add(d),
+		ch:     make(chan time.Time, 1),
+	}
+	f.tickers = append(f.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward, firing any tickers that come due.
+// Like time.Ticker, ticks are dropped if the previous one wasn't consumed.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	for _, t := range f.tickers {
+		if t.stopped {
+			continue
+		}
+		for !t.next.After(f.now) {
+			select {
+			case t.ch <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock   *fakeClock
+	period  time.Duration
+	next    time.Time
+	ch      chan time.Time
+	stopped bool
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.stopped = true
+}
+
+// waitTickers blocks until n tickers are running, so an Advance isn't lost
+// before the collection loop has created its ticker
+func (f *fakeClock) waitTickers(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		running := 0
+		for _, tk := range f.tickers {
+			if !tk.stopped {
+				running++
+			}
+		}
+		f.mu.Unlock()
+		if running >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d tickers running, want %d", running, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitCreated blocks until n tickers were created, running or not
+func (f *fakeClock) waitCreated(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		created := len(f.tickers)
+		f.mu.Unlock()
+		if created >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d tickers created, want %d", created, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// startWithClock starts a collector on a fake clock, reporting each
+// collection's entries on the returned channel
+func startWithClock(t *testing.T, cfg Config) (*Collector, *fakeClock, <-chan []MapEntry) {
+	t.Helper()
+	clock := newFakeClock(time.Unix(1000, 0))
+	collected := make(chan []MapEntry, 1)
+	cfg.Clock = clock
+	cfg.OnCollect = func(entries []MapEntry) { collected <- entries }
+	c, err := NewCollector(cfg)
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	c.Start()
+	t.Cleanup(c.Stop)
+	return c, clock, collected
+}
+
+// expectCollection fails the test unless a collection is reported soon
+func expectCollection(t *testing.T, collected <-chan []MapEntry) []MapEntry {
+	t.Helper()
+	select {
+	case entries := <-collected:
+		return entries
+	case <-time.After(5 * time.Second):
+		t.Fatal("no collection")
+		return nil
+	}
+}
+
+// expectNoCollection fails the test if a collection is reported
+func expectNoCollection(t *testing.T, collected <-chan []MapEntry) {
+	t.Helper()
+	select {
+	case <-collected:
+		t.Fatal("unexpected collection")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCollectorLoopFakeClock(t *testing.T) {
+	m := newCountsMap(t, map[uint32]uint64{selfPID: 1})
+	c, clock, collected := startWithClock(t, Config{
+		CountsMap:  m,
+		Interval:   10 * time.Second,
+		Registerer: prometheus.NewRegistry(),
+	})
+	clock.waitTickers(t, 1)
+
+	clock.Advance(9 * time.Second)
+	expectNoCollection(t, collected)
+
+	clock.Advance(time.Second)
+	if entries := expectCollection(t, collected); len(entries) != 1 || entries[0].Count != 1 {
+		t.Fatalf("entries = %+v, want one entry counting 1", entries)
+	}
+	if got, want := c.Status().NextCollection, clock.Now().Add(10*time.Second); !got.Equal(want) {
+		t.Errorf("NextCollection = %v, want %v", got, want)
+	}
+
+	putEntry(t, m, pid32(selfPID), u64(2))
+	clock.Advance(10 * time.Second)
+	if entries := expectCollection(t, collected); entries[0].Count != 2 {
+		t.Errorf("second collection count = %d, want 2", entries[0].Count)
+	}
+}
+
+func TestCollectorWarmupDelay(t *testing.T) {
+	c, clock, collected := startWithClock(t, Config{
+		CountsMap:   newCountsMap(t, map[uint32]uint64{selfPID: 1}),
+		Interval:    10 * time.Second,
+		WarmupDelay: 30 * time.Second,
+		Registerer:  prometheus.NewRegistry(),
+	})
+	clock.waitTickers(t, 1)
+	if got, want := c.Status().NextCollection, clock.Now().Add(40*time.Second); !got.Equal(want) {
+		t.Errorf("NextCollection during warm-up = %v, want %v", got, want)
+	}
+
+	clock.Advance(30 * time.Second)
+	expectNoCollection(t, collected)
+	// The loop's ticker replaces the warm-up one once it fired
+	clock.waitCreated(t, 2)
+	clock.waitTickers(t, 1)
+	clock.Advance(10 * time.Second)
+	expectCollection(t, collected)
+}
+
+func TestStaleSeriesGrace(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	clock := newFakeClock(time.Unix(1000, 0))
+	m := newCountsMap(t, map[uint32]uint64{1: 1})
+	c, err := NewCollector(Config{CountsMap: m, Registerer: reg, Clock: clock, StaleSeriesGrace: time.Minute})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	c.resolveName = func(int) string { return "bursty" }
+
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	if err := m.Delete(pid32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(30 * time.Second)
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	if !commsOf(t, reg)["bursty"] {
+		t.Error("series deleted within the grace window")
+	}
+
+	clock.Advance(30 * time.Second)
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	if commsOf(t, reg)["bursty"] {
+		t.Error("series kept after the grace window")
+	}
+}
@@ -1,23 +1,103 @@
 package metrics
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"os"
+	"slices"
 	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/rogerwesterbo/ebpf-testing/internal/procfs"
 )
 
 // Collector collects and exports eBPF metrics to Prometheus
 type Collector struct {
-	countsMap   *ebpf.Map
-	countsGauge *prometheus.GaugeVec
+	countsMap   func() *ebpf.Map
+	ownedMap    *ebpf.Map
+	gauges      []*prometheus.GaugeVec
+	gaugeFields []string
+	decoder     ValueDecoder
 	interval    time.Duration
+	warmup      time.Duration
+	pullMode    bool
+	clock       Clock
+	exemplars   *exemplarCollector
+	changed     *changedCollector
+	labelNames  []string
 	stopChan    chan struct{}
 	onError     func(error)
+
+	registerer prometheus.Registerer
+	registered []prometheus.Collector
+	gatherer   prometheus.Gatherer
+
+	directionKey bool
+	extraMaps    []*extraMap
+	dportKey     bool
+	familyKey    bool
+	portOnly     bool
+	services     map[string]string
+	resolvePod   func(pid int) (procfs.Pod, error)
+	serviceDef   string
+	snapshotFile string
+	table        io.Writer
+	onCollect    func([]MapEntry)
+	resolveName  func(pid int) string
+	cachedName   func(pid int) (string, bool)
+	loadName     func(pid int) string
+	maxResolves  int
+	retries      int
+	byTGID       bool
+	maxPerComm   int
+	readAndClear bool
+	aggregate    bool
+	filter       *commFilter
+	total        atomic.Uint64
+
+	// collectMu serializes collections so baselines aren't updated concurrently
+	collectMu sync.Mutex
+	series    map[string]*seriesState
+	// resolved counts the names loaded by the current collection, for the
+	// counts map and the extra maps together
+	resolved        int
+	staleGrace      time.Duration
+	entriesDelta    prometheus.Gauge
+	distinctComms   prometheus.Gauge
+	invalidLabels   prometheus.Counter
+	readDuration    prometheus.Observer
+	resolveDuration prometheus.Observer
+
+	timestampField string
+	bootTime       time.Time
+	lastConnect    *prometheus.GaugeVec
+	oldestAge      *oldestEntryAge
+
+	threshold     uint64
+	overThreshold *prometheus.GaugeVec
+
+	logger          *slog.Logger
+	slowThreshold   time.Duration
+	slowCollections prometheus.Counter
+	timeout         time.Duration
+	timeouts        prometheus.Counter
+	prevEntries     int
+	hasPrev         bool
+
+	mu             sync.RWMutex
+	last           []MapEntry
+	lastCollection time.Time
+	nextCollection time.Time
 }
 
 // Config holds the configuration for the metrics collector
@@ -25,40 +105,614 @@ type Config struct {
 	CountsMap *ebpf.Map
 	Interval  time.Duration
 	OnError   func(error)
+
+	// CountsMapSource, when set, is called every collection to get the
+	// current map, so it can be swapped (e.g. by Manager.Reload) without
+	// recreating the collector. It takes precedence over CountsMap.
+	CountsMapSource func() *ebpf.Map
+
+	// Clock drives the collection loop; defaults to the system clock
+	Clock Clock
+
+	// WarmupDelay postpones the collection loop after Start, so the first
+	// collection happens WarmupDelay plus one Interval later, once the
+	// probe has had time to observe traffic. Zero starts the loop at once.
+	WarmupDelay time.Duration
+
+	// PullMode disables the background loop: Start is a no-op and the map
+	// is only read by CollectNow or a gather through CollectingGatherer,
+	// for embedders that control when collection happens
+	PullMode bool
+
+	// EmitOnlyChanged exports a per-PID series only when its value changed
+	// in the latest collection, to cut payload and churn. Every gather until
+	// the next collection sees the same series, so set Interval to the
+	// scrape interval or changes between scrapes go unseen. Prometheus marks
+	// a series stale once a scrape omits it, so between changes instant
+	// queries return nothing for it; query with last_over_time over a window
+	// instead. It can't be combined with ExemplarLabel.
+	EmitOnlyChanged bool
+
+	// ExemplarLabel enables trace exemplars when set. The map value is then
+	// expected to hold a uint64 count followed by a 16-byte trace ID, which
+	// is attached to each series under this label name.
+	ExemplarLabel string
+
+	// DirectionKey indicates map keys carry a uint32 direction after the PID
+	// (1 = egress connect, 2 = ingress accept), exported as a direction label
+	DirectionKey bool
+
+	// SnapshotFile, when set, receives a text exposition snapshot of the
+	// collector's registry after every collection for air-gapped pickup
+	SnapshotFile string
+
+	// OnCollect is called with a copy of the snapshot after every successful
+	// collection. It runs on the collection goroutine, so it must return
+	// quickly or hand the entries off asynchronously.
+	OnCollect func(entries []MapEntry)
+
+	// ValueDecoder decodes map values; defaults to a single uint64 count.
+	// Use NewStructDecoder for multi-field counters, which export one
+	// tcp_connects_by_pid_<field> gauge per field.
+	ValueDecoder ValueDecoder
+
+	// NameCacheSize enables an LRU cache of process names holding at most
+	// this many PIDs. Zero disables caching and reads /proc every scrape.
+	NameCacheSize int
+
+	// ObserveProcReads records procfs_read_duration_seconds around each
+	// /proc name read (cache hits excluded). Off by default to avoid overhead.
+	ObserveProcReads bool
+
+	// Registerer receives the collector's metrics; defaults to the
+	// Prometheus default registerer. The package registers nothing at init,
+	// so embedders using promauto only see metrics of collectors they create.
+	Registerer prometheus.Registerer
+
+	// IterateRetries is how many times a failed map read is retried before
+	// the error is reported, smoothing over transient EBUSY/EINTR. Zero
+	// uses the default of 1; negative disables retries.
+	IterateRetries int
+
+	// AggregateByTGID sums the counts of all threads of a process under its
+	// TGID, labeled with the thread group leader's comm
+	AggregateByTGID bool
+
+	// MaxPIDsPerComm bounds the series of processes that spawn many
+	// short-lived children: beyond this many PIDs with the same comm, the
+	// rest are summed into one pid="aggregated" series. Zero disables it.
+	MaxPIDsPerComm int
+
+	// SanitizeComm replaces invalid UTF-8 and non-printable characters in
+	// process names so they are always safe label values
+	SanitizeComm bool
+	// LowercaseComm additionally lowercases sanitized process names
+	LowercaseComm bool
+
+	// Aggregate exports only tcp_connects_total, the sum of every map entry,
+	// instead of per-PID series. Process names are only resolved for filtering.
+	Aggregate bool
+
+	// NameFallbacks is the ordered list of sources tried when resolving a
+	// process name, e.g. comm then cmdline then exe. Empty reads comm only.
+	NameFallbacks []NameSource
+
+	// CommAllowlist, when set, keeps only entries whose comm is listed.
+	// CommDenylist drops entries whose comm is listed; it is applied after
+	// the allowlist, so a name on both lists is dropped.
+	CommAllowlist []string
+	CommDenylist  []string
+
+	// SlowCollectionThreshold logs a warning and counts
+	// ebpf_slow_collections_total when a collection takes longer. Zero disables.
+	SlowCollectionThreshold time.Duration
+
+	// Logger receives structured collector warnings; defaults to slog.Default()
+	Logger *slog.Logger
+
+	// MaxNameResolvesPerScrape caps the /proc name reads per collection.
+	// PIDs beyond the cap use a cached name or are labeled "pending" until a
+	// later collection reads them. It needs a name cache, so one of
+	// procfs.DefaultCacheSize is enabled when NameCacheSize is zero. Zero is
+	// unlimited.
+	MaxNameResolvesPerScrape int
+
+	// ConstLabels are added to every per-PID series, e.g. a node name
+	ConstLabels prometheus.Labels
+
+	// InstanceLabels identify this agent deployment, e.g.
+	// {"instance_role": "connect-tracer"}, and are added to every metric the
+	// collector registers, not only per-PID series. They must not reuse the
+	// name of a per-PID or const label.
+	InstanceLabels prometheus.Labels
+
+	// ConnectThreshold exports ebpf_pid_over_threshold, 1 for each PID whose
+	// count exceeds it and 0 otherwise. Zero disables it; it has no effect
+	// in Aggregate mode.
+	ConnectThreshold uint64
+
+	// CollectionTimeout bounds a whole collection. On timeout the entries
+	// read so far are published, with unresolved names labeled "pending",
+	// and ebpf_collection_timeouts_total is incremented. Zero disables it.
+	CollectionTimeout time.Duration
+
+	// TimestampField names a ValueDecoder field holding the kernel time
+	// (bpf_ktime_get_ns) of the last connect. It is exported as the wall-clock
+	// last_connect_timestamp_seconds gauge instead of a raw counter.
+	TimestampField string
+	// OldestEntryAge exports ebpf_oldest_entry_age_seconds, the age of the
+	// oldest TimestampField value, for staleness detection. It requires
+	// TimestampField.
+	OldestEntryAge bool
+
+	// ReadAndClear removes each entry as it is read, so every collection
+	// exports the counts since the previous one rather than running totals.
+	// It can't be combined with Aggregate, whose tcp_connects_total counter
+	// would then only hold the last interval.
+	ReadAndClear bool
+
+	// StaleSeriesGrace is how long a PID may be absent from the map before
+	// its series are deleted, avoiding gaps for bursty processes. Zero
+	// deletes them on the first collection that misses the PID.
+	StaleSeriesGrace time.Duration
+
+	// CommServiceMap adds a service label to per-PID series, looked up by
+	// comm. Unmapped comms get ServiceDefault, which when empty is the same
+	// as having no service label.
+	CommServiceMap map[string]string
+	ServiceDefault string
+
+	// PodLabels adds pod_uid and container_id labels to per-PID series,
+	// read from each PID's cgroup path every collection. Both are empty for
+	// processes outside a Kubernetes pod.
+	PodLabels bool
+
+	// DurationBuckets overrides the buckets of the map read and name resolve
+	// duration histograms, which default to prometheus.DefBuckets. They must
+	// be non-empty, positive and strictly increasing.
+	DurationBuckets []float64
+
+	// DportKey indicates map keys carry the destination port after the PID
+	// (and direction, if present), as a network byte order u16 padded to 4
+	// bytes like skc_dport. It is exported as a dport label.
+	DportKey bool
+	// PortOnly sums entries across PIDs into one series per port, dropping
+	// the pid and comm labels to bound cardinality. It requires DportKey.
+	PortOnly bool
+
+	// FamilyKey indicates map keys carry a uint32 address family after the
+	// PID, direction and dport fields present (AF_INET or AF_INET6),
+	// exported as a family label of ipv4, ipv6 or unknown
+	FamilyKey bool
+
+	// ExtraMaps are additional PID-keyed maps, with the same key layout as
+	// the counts map, read in the same loop and exported as their own
+	// metrics with the shared labels. Their entries are filtered, sampled
+	// and expired like the counts map's. They are not supported with
+	// PortOnly or Aggregate.
+	ExtraMaps []MapMetric
+
+	// StdoutTable prints the entries as a table after every collection, for
+	// local testing without Prometheus. TableWriter overrides os.Stdout.
+	StdoutTable bool
+	TableWriter io.Writer
 }
 
-// NewCollector creates a new metrics collector
-func NewCollector(cfg Config) *Collector {
-	countsGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "tcp_connects_by_pid",
-			Help: "Number of tcp_connect() calls observed per PID",
-		},
-		[]string{"pid", "comm"},
-	)
+// validateBuckets checks histogram buckets are non-empty, positive and
+// strictly increasing
+func validateBuckets(buckets []float64) error {
+	if len(buckets) == 0 {
+		return fmt.Errorf("duration buckets are empty")
+	}
+	for i, b := range buckets {
+		if b <= 0 {
+			return fmt.Errorf("duration bucket %v is not positive", b)
+		}
+		if i > 0 && b <= buckets[i-1] {
+			return fmt.Errorf("duration buckets are not strictly increasing at %v", b)
+		}
+	}
+	return nil
+}
+
+// NameSource identifies where a process name is read from
+type NameSource = procfs.NameSource
+
+// Process name sources usable in Config.NameFallbacks
+const (
+	NameFromComm    = procfs.NameFromComm
+	NameFromCmdline = procfs.NameFromCmdline
+	NameFromExe     = procfs.NameFromExe
+)
+
+// NewCollector creates a new metrics collector. It returns an error if the
+// map's key or value size doesn't match the configured decoding layout.
+func NewCollector(cfg Config) (*Collector, error) {
+	if cfg.PortOnly && !cfg.DportKey {
+		return nil, fmt.Errorf("PortOnly requires DportKey")
+	}
+	if cfg.PortOnly && (cfg.CommAllowlist != nil || cfg.CommDenylist != nil || cfg.CommServiceMap != nil || cfg.PodLabels || cfg.MaxPIDsPerComm > 0) {
+		return nil, fmt.Errorf("PortOnly can't be combined with comm filters, services, pod labels or PID sampling")
+	}
+
+	var labelNames []string
+	if !cfg.PortOnly {
+		labelNames = append(labelNames, "pid", "comm")
+	}
+	if cfg.DirectionKey {
+		labelNames = append(labelNames, "direction")
+	}
+	if cfg.DportKey {
+		labelNames = append(labelNames, "dport")
+	}
+	if cfg.FamilyKey {
+		labelNames = append(labelNames, "family")
+	}
+	if cfg.CommServiceMap != nil {
+		labelNames = append(labelNames, "service")
+	}
+	if cfg.PodLabels {
+		labelNames = append(labelNames, "pod_uid", "container_id")
+	}
+
+	if err := validateInstanceLabels(cfg.InstanceLabels, labelNames, cfg.ConstLabels); err != nil {
+		return nil, err
+	}
+
+	if cfg.ValueDecoder == nil {
+		cfg.ValueDecoder = Uint64Decoder{}
+	} else if err := validateDecoder(cfg.ValueDecoder); err != nil {
+		return nil, err
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = realClock{}
+	}
+	if cfg.DurationBuckets == nil {
+		cfg.DurationBuckets = prometheus.DefBuckets
+	} else if err := validateBuckets(cfg.DurationBuckets); err != nil {
+		return nil, err
+	}
+
+	// Metrics are registered only once the configuration has been validated
+	var collectors []prometheus.Collector
+
+	var gauges []*prometheus.GaugeVec
+	var gaugeFields []string
+	var exemplars *exemplarCollector
+	var changed *changedCollector
+	if cfg.ReadAndClear && cfg.Aggregate {
+		return nil, fmt.Errorf("ReadAndClear can't be combined with Aggregate")
+	}
+	if cfg.EmitOnlyChanged && cfg.ExemplarLabel != "" {
+		return nil, fmt.Errorf("EmitOnlyChanged can't be combined with ExemplarLabel")
+	}
+	if cfg.Aggregate {
+		// Registered below once the collector exists
+	} else if cfg.ExemplarLabel != "" {
+		exemplars = newExemplarCollector(cfg.ExemplarLabel, labelNames, cfg.ConstLabels)
+		collectors = append(collectors, exemplars)
+	} else {
+		var descs []*prometheus.Desc
+		for _, field := range cfg.ValueDecoder.Fields() {
+			if cfg.TimestampField != "" && field == cfg.TimestampField {
+				continue
+			}
+			help := "Number of tcp_connect() calls observed per PID"
+			if field != "" {
+				help = fmt.Sprintf("Per-PID %s counter read from the eBPF map", field)
+			}
+			if cfg.EmitOnlyChanged {
+				descs = append(descs, prometheus.NewDesc(metricName("tcp_connects_by_pid", field), help, labelNames, cfg.ConstLabels))
+				gaugeFields = append(gaugeFields, field)
+				continue
+			}
+			gauge := prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name:        metricName("tcp_connects_by_pid", field),
+					Help:        help,
+					ConstLabels: cfg.ConstLabels,
+				},
+				labelNames,
+			)
+			collectors = append(collectors, gauge)
+			gauges = append(gauges, gauge)
+			gaugeFields = append(gaugeFields, field)
+		}
+		if cfg.EmitOnlyChanged {
+			changed = newChangedCollector(descs)
+			collectors = append(collectors, changed)
+		}
+	}
+
+	if len(cfg.ExtraMaps) > 0 && (cfg.PortOnly || cfg.Aggregate) {
+		return nil, fmt.Errorf("ExtraMaps can't be combined with PortOnly or Aggregate")
+	}
+	var extraMaps []*extraMap
+	for _, mm := range cfg.ExtraMaps {
+		x, err := newExtraMap(mm, labelNames, cfg.ConstLabels)
+		if err != nil {
+			return nil, err
+		}
+		for _, gauge := range x.gauges {
+			collectors = append(collectors, gauge)
+		}
+		extraMaps = append(extraMaps, x)
+	}
+
+	var bootTime time.Time
+	var lastConnect *prometheus.GaugeVec
+	if cfg.TimestampField != "" {
+		if !slices.Contains(cfg.ValueDecoder.Fields(), cfg.TimestampField) {
+			return nil, fmt.Errorf("timestamp field %q is not a value field", cfg.TimestampField)
+		}
+		var err error
+		if bootTime, err = procfs.BootTime(); err != nil {
+			return nil, fmt.Errorf("read boot time: %w", err)
+		}
+		lastConnect = newLastConnectGauge(labelNames, cfg.ConstLabels)
+		collectors = append(collectors, lastConnect)
+	}
+	var oldestAge *oldestEntryAge
+	if cfg.OldestEntryAge {
+		if cfg.TimestampField == "" {
+			return nil, fmt.Errorf("OldestEntryAge requires TimestampField")
+		}
+		oldestAge = newOldestEntryAge(cfg.ConstLabels, cfg.Clock.Now)
+		collectors = append(collectors, oldestAge)
+	}
+
+	if cfg.CountsMapSource == nil {
+		countsMap := cfg.CountsMap
+		cfg.CountsMapSource = func() *ebpf.Map { return countsMap }
+	}
+
+	var resolvePod func(pid int) (procfs.Pod, error)
+	if cfg.PodLabels {
+		resolvePod = procfs.PodInfo
+	}
+
+	resolveName := procfs.GetProcessName
+	if len(cfg.NameFallbacks) > 0 {
+		resolveName = procfs.NewNameResolver(cfg.NameFallbacks)
+	}
+	if cfg.ObserveProcReads {
+		readDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "procfs_read_duration_seconds",
+			Help:    "Time spent reading a process name from /proc",
+			Buckets: prometheus.ExponentialBuckets(1e-6, 4, 10),
+		})
+		collectors = append(collectors, readDuration)
+		resolveName = timedLookup(resolveName, readDuration)
+	}
+	if cfg.MaxNameResolvesPerScrape > 0 && cfg.NameCacheSize == 0 {
+		// Without a cache the PIDs over the cap would stay pending forever
+		cfg.NameCacheSize = procfs.DefaultCacheSize
+	}
+	var cachedName func(pid int) (string, bool)
+	var loadName func(pid int) string
+	if cfg.NameCacheSize > 0 {
+		cache := procfs.NewCacheWithLookup(cfg.NameCacheSize, resolveName)
+		collectors = append(collectors, cacheMetrics(cache)...)
+		resolveName = cache.GetProcessName
+		cachedName = cache.Peek
+		loadName = cache.Load
+	}
 
-	prometheus.MustRegister(countsGauge)
+	if cfg.SanitizeComm {
+		lower := cfg.LowercaseComm
+		sanitized := func(lookup func(pid int) string) func(pid int) string {
+			return func(pid int) string {
+				return sanitizeComm(lookup(pid), lower)
+			}
+		}
+		resolveName = sanitized(resolveName)
+		if loadName != nil {
+			loadName = sanitized(loadName)
+		}
+		if peek := cachedName; peek != nil {
+			cachedName = func(pid int) (string, bool) {
+				name, ok := peek(pid)
+				return sanitizeComm(name, lower), ok
+			}
+		}
+	}
 
 	if cfg.Interval == 0 {
 		cfg.Interval = 5 * time.Second
 	}
+	if cfg.IterateRetries == 0 {
+		cfg.IterateRetries = 1
+	} else if cfg.IterateRetries < 0 {
+		cfg.IterateRetries = 0
+	}
+
+	entriesDelta := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ebpf_map_entries_delta",
+		Help: "Change in the number of map entries since the previous collection (may be negative)",
+	})
+	invalidLabels := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ebpf_invalid_label_values_total",
+		Help: "Number of process names replaced because they were not valid label values",
+	})
+	distinctComms := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ebpf_distinct_comms",
+		Help: "Number of distinct process names in the last collection",
+	})
+	collectors = append(collectors, entriesDelta, invalidLabels, distinctComms)
+
+	mapReadDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ebpf_map_read_duration_seconds",
+		Help:    "Time spent iterating the eBPF map per collection",
+		Buckets: cfg.DurationBuckets,
+	})
+	nameResolveDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ebpf_name_resolve_duration_seconds",
+		Help:    "Time spent resolving process names per collection",
+		Buckets: cfg.DurationBuckets,
+	})
+	collectors = append(collectors, mapReadDuration, nameResolveDuration)
+
+	var overThreshold *prometheus.GaugeVec
+	if cfg.ConnectThreshold > 0 && !cfg.Aggregate {
+		overThreshold = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        "ebpf_pid_over_threshold",
+				Help:        "Whether the PID's connect count exceeds the configured threshold (1) or not (0)",
+				ConstLabels: cfg.ConstLabels,
+			},
+			labelNames,
+		)
+		collectors = append(collectors, overThreshold)
+	}
+
+	var slowCollections prometheus.Counter
+	if cfg.SlowCollectionThreshold > 0 {
+		slowCollections = prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ebpf_slow_collections_total",
+			Help: "Number of collections that exceeded the slow collection threshold",
+		})
+		collectors = append(collectors, slowCollections)
+	}
+	var timeouts prometheus.Counter
+	if cfg.CollectionTimeout > 0 {
+		timeouts = prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ebpf_collection_timeouts_total",
+			Help: "Number of collections cut short by the collection timeout",
+		})
+		collectors = append(collectors, timeouts)
+	}
+	var table io.Writer
+	if cfg.StdoutTable {
+		table = cfg.TableWriter
+		if table == nil {
+			table = os.Stdout
+		}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
 
-	return &Collector{
-		countsMap:   cfg.CountsMap,
-		countsGauge: countsGauge,
+	c := &Collector{
+		countsMap:   cfg.CountsMapSource,
+		gauges:      gauges,
+		gaugeFields: gaugeFields,
+		decoder:     cfg.ValueDecoder,
+		exemplars:   exemplars,
+		changed:     changed,
+		labelNames:  labelNames,
 		interval:    cfg.Interval,
+		warmup:      cfg.WarmupDelay,
+		pullMode:    cfg.PullMode,
+		clock:       cfg.Clock,
 		stopChan:    make(chan struct{}),
 		onError:     cfg.OnError,
+
+		directionKey:  cfg.DirectionKey,
+		dportKey:      cfg.DportKey,
+		familyKey:     cfg.FamilyKey,
+		extraMaps:     extraMaps,
+		portOnly:      cfg.PortOnly,
+		services:      cfg.CommServiceMap,
+		serviceDef:    cfg.ServiceDefault,
+		snapshotFile:  cfg.SnapshotFile,
+		table:         table,
+		onCollect:     cfg.OnCollect,
+		resolveName:   resolveName,
+		resolvePod:    resolvePod,
+		cachedName:    cachedName,
+		loadName:      loadName,
+		maxResolves:   cfg.MaxNameResolvesPerScrape,
+		retries:       cfg.IterateRetries,
+		byTGID:        cfg.AggregateByTGID,
+		maxPerComm:    cfg.MaxPIDsPerComm,
+		readAndClear:  cfg.ReadAndClear,
+		aggregate:     cfg.Aggregate,
+		filter:        newCommFilter(cfg.CommAllowlist, cfg.CommDenylist),
+		entriesDelta:  entriesDelta,
+		distinctComms: distinctComms,
+		invalidLabels: invalidLabels,
+		staleGrace:    cfg.StaleSeriesGrace,
+
+		readDuration:    mapReadDuration,
+		resolveDuration: nameResolveDuration,
+
+		timestampField: cfg.TimestampField,
+		bootTime:       bootTime,
+		lastConnect:    lastConnect,
+		oldestAge:      oldestAge,
+
+		threshold:     cfg.ConnectThreshold,
+		overThreshold: overThreshold,
+
+		logger:          cfg.Logger,
+		slowThreshold:   cfg.SlowCollectionThreshold,
+		slowCollections: slowCollections,
+		timeout:         cfg.CollectionTimeout,
+		timeouts:        timeouts,
+	}
+
+	if cfg.Aggregate {
+		collectors = append(collectors, prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Name:        "tcp_connects_total",
+				Help:        "Sum of tcp_connect() calls across all entries in the eBPF map",
+				ConstLabels: cfg.ConstLabels,
+			},
+			func() float64 { return float64(c.total.Load()) },
+		))
 	}
+
+	if m := c.countsMap(); m != nil {
+		if err := c.validateMap(m); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Registerer == nil {
+		cfg.Registerer = prometheus.DefaultRegisterer
+	}
+	// Snapshots gather from the injected registry when it can be gathered
+	c.gatherer = prometheus.DefaultGatherer
+	if g, ok := cfg.Registerer.(prometheus.Gatherer); ok {
+		c.gatherer = g
+	}
+	if len(cfg.InstanceLabels) > 0 {
+		cfg.Registerer = prometheus.WrapRegistererWith(cfg.InstanceLabels, cfg.Registerer)
+	}
+	if err := registerAll(cfg.Registerer, collectors...); err != nil {
+		return nil, err
+	}
+	c.registerer = cfg.Registerer
+	c.registered = collectors
+	return c, nil
 }
 
-type pidCount struct {
-	pid uint32
-	val uint64
+// MapEntry is a single PID's connect count read from the eBPF map
+type MapEntry struct {
+	PID       uint32 `json:"pid"`
+	Comm      string `json:"comm"`
+	Count     uint64 `json:"count"`
+	TraceID   string `json:"trace_id,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	Dport     uint16 `json:"dport,omitempty"`
+	Family    string `json:"family,omitempty"`
+
+	// Aggregated marks an entry summing the PIDs of a comm beyond
+	// MaxPIDsPerComm; its PID is 0 and it is exported as pid="aggregated"
+	Aggregated bool `json:"aggregated,omitempty"`
+
+	PodUID      string `json:"pod_uid,omitempty"`
+	ContainerID string `json:"container_id,omitempty"`
+
+	// Values holds every decoded field for multi-field counters; Count is the first
+	Values map[string]uint64 `json:"values,omitempty"`
 }
 
-// Start begins collecting metrics
+// Start begins collecting metrics. It does nothing in PullMode.
 func (c *Collector) Start() {
+	if c.pullMode {
+		return
+	}
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
@@ -71,13 +725,35 @@ func (c *Collector) Start() {
 			}
 		}()
 
-		ticker := time.NewTicker(c.interval)
+		if c.warmup > 0 {
+			c.setNextCollection(c.clock.Now().Add(c.warmup + c.interval))
+			if !c.wait(c.warmup) {
+				return
+			}
+		}
+
+		ticker := c.clock.NewTicker(c.interval)
 		defer ticker.Stop()
+		c.setNextCollection(c.clock.Now().Add(c.interval))
 
 		for {
 			select {
-			case <-ticker.C:
-				c.collect()
+			case tick := <-ticker.C():
+				c.setNextCollection(tick.Add(c.interval))
+				entries, err := c.collect()
+				if err != nil && c.onError != nil {
+					c.onError(err)
+				}
+				if c.table != nil && entries != nil {
+					if err := WriteTable(c.table, entries); err != nil {
+						log.Printf("Failed to print metrics table: %v", err)
+					}
+				}
+				if c.snapshotFile != "" {
+					if err := WriteToFile(c.snapshotFile, c.gatherer); err != nil {
+						log.Printf("Failed to write metrics snapshot: %v", err)
+					}
+				}
 			case <-c.stopChan:
 				return
 			}
@@ -86,32 +762,412 @@ func (c *Collector) Start() {
 }
 
 // collect reads the eBPF map and updates Prometheus metrics
-func (c *Collector) collect() {
-	iter := c.countsMap.Iterate()
-	counts := make([]pidCount, 0, 256)
+func (c *Collector) collect() ([]MapEntry, error) {
+	c.collectMu.Lock()
+	defer c.collectMu.Unlock()
+
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	began := c.clock.Now()
+	start := time.Now()
+	entries, mapEntries, err := c.readEntries(ctx)
+	for attempt := 0; err != nil && entries == nil && ctx.Err() == nil && attempt < c.retries; attempt++ {
+		entries, mapEntries, err = c.readEntries(ctx)
+	}
+	if err != nil && entries == nil {
+		return nil, err
+	}
+	// Entries of a partial drain are already gone from the map, so they are
+	// published and the read error reported alongside them
+	readErr := err
+	c.readDuration.Observe(time.Since(start).Seconds())
+
+	start = time.Now()
+	c.resolved = 0
+	c.resolveNames(ctx, entries)
+	c.resolvePods(ctx, entries)
+	c.resolveDuration.Observe(time.Since(start).Seconds())
+	c.validateComms(entries)
+	// Remembered before filtering so the extra maps drop the same processes
+	known := c.processes(entries)
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		c.timeouts.Inc()
+		c.logger.Warn("Metrics collection timed out, publishing partial results",
+			"timeout", c.timeout,
+			"entries", len(entries),
+		)
+	}
+
+	entries = c.selectEntries(entries, c.timestampField)
+
+	c.publish(entries)
+	c.publishThreshold(entries)
+	c.publishTimestamps(entries)
+	// The counts map is still published when an extra map fails
+	extraErr := c.collectExtraMaps(ctx, known)
+	c.observeMapEntries(mapEntries)
+	c.distinctComms.Set(float64(countDistinctComms(entries)))
+
+	now := c.clock.Now()
+	// A partial read says nothing about which PIDs went away, but the series
+	// it published, such as pending ones, must still expire later
+	c.expireStale(entries, now, ctx.Err() == nil)
 
-	var pid uint32
-	var val uint64
-	for iter.Next(&pid, &val) {
-		counts = append(counts, pidCount{pid, val})
+	if entries == nil {
+		// Callers tell a failed counts map read apart by its nil entries
+		entries = []MapEntry{}
 	}
 
-	// Sort by PID for consistent ordering
-	sort.Slice(counts, func(i, j int) bool {
-		return counts[i].pid < counts[j].pid
+	c.mu.Lock()
+	c.last = entries
+	c.lastCollection = now
+	c.mu.Unlock()
+
+	c.checkSlow(now.Sub(began), len(entries))
+
+	if c.onCollect != nil {
+		snapshot := make([]MapEntry, len(entries))
+		copy(snapshot, entries)
+		c.onCollect(snapshot)
+	}
+
+	return entries, errors.Join(readErr, extraErr)
+}
+
+// Snapshot returns a copy of the entries read by the latest successful collection
+func (c *Collector) Snapshot() []MapEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snapshot := make([]MapEntry, len(c.last))
+	copy(snapshot, c.last)
+	return snapshot
+}
+
+// CollectNow performs a single collection immediately and returns the entries read
+func (c *Collector) CollectNow() ([]MapEntry, error) {
+	return c.collect()
+}
+
+// CollectingGatherer wraps g to collect before every gather, so in PullMode
+// each scrape exports a fresh read of the map. A failed collection is
+// reported to OnError and the previous values are gathered.
+func (c *Collector) CollectingGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		if _, err := c.collect(); err != nil && c.onError != nil {
+			c.onError(err)
+		}
+		return g.Gather()
 	})
+}
+
+// readEntries iterates and decodes the eBPF map, stopping early with the
+// entries read so far when ctx is done. It also returns the number of raw
+// map entries read, before any aggregation. A failed drain returns the
+// entries it removed along with the error.
+func (c *Collector) readEntries(ctx context.Context) ([]MapEntry, int, error) {
+	countsMap := c.countsMap()
+	if countsMap == nil {
+		return nil, 0, fmt.Errorf("no counts map available")
+	}
+
+	var entries []MapEntry
+	var err error
+	switch {
+	case c.readAndClear:
+		entries, err = c.drainEntries(ctx, countsMap)
+	case isMmapable(countsMap) && c.keySize() == 4:
+		entries, err = c.mmapEntries(ctx, countsMap)
+	default:
+		entries, err = c.iterateEntries(ctx, countsMap)
+	}
+	if err != nil && entries == nil {
+		return nil, 0, err
+	}
+	mapEntries := len(entries)
+
+	switch {
+	case c.portOnly:
+		entries = aggregateByPort(entries, c.timestampField)
+	case c.byTGID:
+		entries = aggregateByTGID(entries, procfs.GetTGID, c.timestampField)
+	default:
+		// Sort by PID for consistent ordering
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].PID < entries[j].PID
+		})
+	}
+
+	return entries, mapEntries, err
+}
+
+// iterateEntries reads and decodes every entry of the map
+func (c *Collector) iterateEntries(ctx context.Context, m *ebpf.Map) ([]MapEntry, error) {
+	iter := m.Iterate()
+	entries := make([]MapEntry, 0, 256)
+
+	var key, value []byte
+	for ctx.Err() == nil && iter.Next(&key, &value) {
+		e, err := c.decodeEntry(key, value)
+		if err != nil {
+			return nil, fmt.Errorf("decode entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("iterate map: %w", err)
+	}
+	return entries, nil
+}
+
+// resolveNames fills in the process name of each entry, labeling the rest
+// "pending" once ctx is done or MaxNameResolvesPerScrape names were loaded
+// by the collection. Aggregate mode skips it unless names are needed for
+// filtering.
+func (c *Collector) resolveNames(ctx context.Context, entries []MapEntry) {
+	if (c.aggregate && c.filter == nil) || c.portOnly {
+		return
+	}
+	for i := range entries {
+		pid := int(entries[i].PID)
+		if ctx.Err() != nil {
+			entries[i].Comm = "pending"
+			continue
+		}
+		if c.maxResolves == 0 {
+			entries[i].Comm = c.resolveName(pid)
+			continue
+		}
+		if name, ok := c.cachedName(pid); ok {
+			entries[i].Comm = name
+			continue
+		}
+		if c.resolved >= c.maxResolves {
+			entries[i].Comm = "pending"
+			continue
+		}
+		c.resolved++
+		entries[i].Comm = c.loadName(pid)
+	}
+}
+
+// selectEntries applies the comm filters and the per-comm PID limit
+func (c *Collector) selectEntries(entries []MapEntry, timestampField string) []MapEntry {
+	if c.filter != nil {
+		entries = c.filter.apply(entries)
+	}
+	if c.maxPerComm > 0 && !c.aggregate {
+		entries = sampleByComm(entries, c.maxPerComm, timestampField)
+	}
+	return entries
+}
+
+// resolvePods fills in the pod of each entry when pod labels are enabled.
+// Lookups failing because the process has exited leave the labels empty.
+func (c *Collector) resolvePods(ctx context.Context, entries []MapEntry) {
+	if c.resolvePod == nil || c.aggregate {
+		return
+	}
+	for i := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		if pod, err := c.resolvePod(int(entries[i].PID)); err == nil {
+			entries[i].PodUID = pod.UID
+			entries[i].ContainerID = pod.ContainerID
+		}
+	}
+}
+
+// publish exports the entries to the registered Prometheus metrics
+func (c *Collector) publish(entries []MapEntry) {
+	if c.aggregate {
+		var total uint64
+		for _, e := range entries {
+			total += e.Count
+		}
+		c.total.Store(total)
+		return
+	}
+
+	if c.exemplars != nil {
+		samples := make([]exemplarSample, 0, len(entries))
+		for _, e := range entries {
+			samples = append(samples, exemplarSample{
+				labelValues: c.labelValues(e),
+				count:       e.Count,
+				traceID:     e.TraceID,
+			})
+		}
+		c.exemplars.update(samples)
+		return
+	}
+
+	if c.changed != nil {
+		samples := make([]changedSample, 0, len(entries))
+		for _, e := range entries {
+			values := make([]float64, len(c.gaugeFields))
+			for i, field := range c.gaugeFields {
+				values[i] = float64(e.Count)
+				if e.Values != nil {
+					values[i] = float64(e.Values[field])
+				}
+			}
+			samples = append(samples, changedSample{labelValues: c.labelValues(e), values: values})
+		}
+		c.changed.update(samples)
+		return
+	}
 
 	// Update gauges
-	for _, pc := range counts {
-		labels := prometheus.Labels{
-			"pid":  strconv.Itoa(int(pc.pid)),
-			"comm": procfs.GetProcessName(int(pc.pid)),
+	for _, e := range entries {
+		labels := c.labelValues(e)
+		for i, gauge := range c.gauges {
+			value := e.Count
+			if e.Values != nil {
+				value = e.Values[c.gaugeFields[i]]
+			}
+			gauge.WithLabelValues(labels...).Set(float64(value))
+		}
+	}
+}
+
+// publishThreshold flags the PIDs whose count exceeds the connect threshold
+func (c *Collector) publishThreshold(entries []MapEntry) {
+	if c.overThreshold == nil {
+		return
+	}
+	for _, e := range entries {
+		over := 0.0
+		if e.Count > c.threshold {
+			over = 1
+		}
+		c.overThreshold.WithLabelValues(c.labelValues(e)...).Set(over)
+	}
+}
+
+// OnMapSwap resets the collector's baselines after the counts map has been
+// replaced, e.g. by Manager.Reload, so the next collection reports zero
+// deltas and emits every changed-only series instead of comparing against
+// the old map
+func (c *Collector) OnMapSwap() {
+	c.collectMu.Lock()
+	defer c.collectMu.Unlock()
+	c.prevEntries = 0
+	c.hasPrev = false
+	if c.changed != nil {
+		c.changed.reset()
+	}
+}
+
+// observeMapEntries publishes the change in map size since the previous
+// collection. The first collection has no baseline and reports 0.
+func (c *Collector) observeMapEntries(n int) {
+	delta := 0
+	if c.hasPrev {
+		delta = n - c.prevEntries
+	}
+	c.prevEntries = n
+	c.hasPrev = true
+	c.entriesDelta.Set(float64(delta))
+}
+
+// countDistinctComms returns the number of distinct resolved process names.
+// Entries without a name, as in PortOnly mode, aren't counted.
+func countDistinctComms(entries []MapEntry) int {
+	comms := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		if e.Comm != "" {
+			comms[e.Comm] = struct{}{}
+		}
+	}
+	return len(comms)
+}
+
+// checkSlow reports a collection that took longer than the slow threshold
+func (c *Collector) checkSlow(took time.Duration, entries int) {
+	if c.slowThreshold <= 0 || took <= c.slowThreshold {
+		return
+	}
+	c.slowCollections.Inc()
+	c.logger.Warn("Slow metrics collection",
+		"duration", took,
+		"threshold", c.slowThreshold,
+		"entries", entries,
+	)
+}
+
+// labelValues returns the entry's label values in labelNames order
+func (c *Collector) labelValues(e MapEntry) []string {
+	var values []string
+	if !c.portOnly {
+		values = append(values, e.pidLabel(), e.Comm)
+	}
+	if c.directionKey {
+		values = append(values, e.Direction)
+	}
+	if c.dportKey {
+		values = append(values, strconv.Itoa(int(e.Dport)))
+	}
+	if c.familyKey {
+		values = append(values, e.Family)
+	}
+	if c.services != nil {
+		service, ok := c.services[e.Comm]
+		if !ok {
+			service = c.serviceDef
 		}
-		c.countsGauge.With(labels).Set(float64(pc.val))
+		values = append(values, service)
+	}
+	if c.resolvePod != nil {
+		values = append(values, e.PodUID, e.ContainerID)
+	}
+	return values
+}
+
+// timedLookup wraps a name lookup to observe its duration
+func timedLookup(lookup func(pid int) string, observer prometheus.Observer) func(pid int) string {
+	return func(pid int) string {
+		start := time.Now()
+		name := lookup(pid)
+		observer.Observe(time.Since(start).Seconds())
+		return name
 	}
 }
 
-// Stop stops the metrics collection
+// Unregister removes the collector's metrics from its Registerer, so a
+// replacement collector can register the same metrics
+func (c *Collector) Unregister() {
+	for _, r := range c.registered {
+		c.registerer.Unregister(r)
+	}
+}
+
+// wait blocks for d on the collector's clock, reporting false if the
+// collector was stopped first
+func (c *Collector) wait(d time.Duration) bool {
+	t := c.clock.NewTicker(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C():
+		return true
+	case <-c.stopChan:
+		return false
+	}
+}
+
+// Stop stops the metrics collection and closes the map if the collector opened it
 func (c *Collector) Stop() {
 	close(c.stopChan)
+	if c.ownedMap != nil {
+		c.collectMu.Lock()
+		defer c.collectMu.Unlock()
+		c.ownedMap.Close()
+	}
 }
@@ -0,0 +1,360 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestMap creates a map for the test, skipping it where BPF maps can't be
+// created (e.g. without CAP_BPF)
+func newTestMap(t testing.TB, spec *ebpf.MapSpec) *ebpf.Map {
+	t.Helper()
+	if spec.MaxEntries == 0 {
+		spec.MaxEntries = 64
+	}
+	m, err := ebpf.NewMap(spec)
+	if err != nil {
+		t.Skipf("creating BPF map: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// newCountsMap creates a PID-keyed hash map of uint64 counts holding counts
+func newCountsMap(t *testing.T, counts map[uint32]uint64) *ebpf.Map {
+	t.Helper()
+	m := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: 8})
+	for pid, count := range counts {
+		putEntry(t, m, pid32(pid), u64(count))
+	}
+	return m
+}
+
+// putEntry writes a raw key and value into m
+func putEntry(t testing.TB, m *ebpf.Map, key, value []byte) {
+	t.Helper()
+	if err := m.Put(key, value); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+}
+
+// pid32 encodes a uint32 key field
+func pid32(v uint32) []byte {
+	return binary.NativeEndian.AppendUint32(nil, v)
+}
+
+// u64 encodes uint64 value fields
+func u64(values ...uint64) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.NativeEndian.AppendUint64(b, v)
+	}
+	return b
+}
+
+// selfPID is the PID of the test binary, whose comm is always resolvable
+var selfPID = uint32(os.Getpid())
+
+// gather returns the metric family called name, or nil if it wasn't gathered
+func gather(t *testing.T, g prometheus.Gatherer, name string) *dto.MetricFamily {
+	t.Helper()
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// labels returns the label pairs of m as a map
+func labels(m *dto.Metric) map[string]string {
+	out := make(map[string]string, len(m.GetLabel()))
+	for _, l := range m.GetLabel() {
+		out[l.GetName()] = l.GetValue()
+	}
+	return out
+}
+
+// findMetric returns the metric of f whose labels include want, or nil
+func findMetric(f *dto.MetricFamily, want map[string]string) *dto.Metric {
+	for _, m := range f.GetMetric() {
+		got := labels(m)
+		match := true
+		for k, v := range want {
+			if got[k] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			return m
+		}
+	}
+	return nil
+}
+
+func TestCollectorServiceLabel(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newCountsMap(t, map[uint32]uint64{selfPID: 3, 999999: 5})
+	c, err := NewCollector(Config{
+		CountsMap:      m,
+		Registerer:     reg,
+		CommServiceMap: map[string]string{"metrics.test": "tests"},
+		ServiceDefault: "other",
+	})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+
+	f := gather(t, reg, "tcp_connects_by_pid")
+	if f == nil {
+		t.Fatal("tcp_connects_by_pid not gathered")
+	}
+	if m := findMetric(f, map[string]string{"comm": "metrics.test"}); m == nil || labels(m)["service"] != "tests" {
+		t.Errorf("mapped comm: got %v, want service=tests", m)
+	}
+	if m := findMetric(f, map[string]string{"pid": "999999"}); m == nil || labels(m)["service"] != "other" {
+		t.Errorf("unmapped comm: got %v, want service=other", m)
+	}
+}
+
+// newTestCollector creates a collector for cfg on a fresh registry
+func newTestCollector(t *testing.T, cfg Config) (*Collector, *prometheus.Registry) {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	cfg.Registerer = reg
+	c, err := NewCollector(cfg)
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	return c, reg
+}
+
+// collectNow runs one collection, failing the test on error
+func collectNow(t *testing.T, c *Collector) []MapEntry {
+	t.Helper()
+	entries, err := c.CollectNow()
+	if err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	return entries
+}
+
+func TestCollectorDistinctComms(t *testing.T) {
+	c, reg := newTestCollector(t, Config{CountsMap: newCountsMap(t, map[uint32]uint64{selfPID: 1, 999998: 2, 999999: 3})})
+	collectNow(t, c)
+	// This process plus the two unresolvable PIDs, which share "unknown"
+	if got := gaugeValue(t, reg, "ebpf_distinct_comms"); got != 2 {
+		t.Fatalf("ebpf_distinct_comms = %v, want 2", got)
+	}
+}
+
+func TestCollectorMapEntriesDelta(t *testing.T) {
+	m := newCountsMap(t, map[uint32]uint64{selfPID: 1})
+	c, reg := newTestCollector(t, Config{CountsMap: m})
+
+	collectNow(t, c)
+	if got := gaugeValue(t, reg, "ebpf_map_entries_delta"); got != 0 {
+		t.Errorf("first collection delta = %v, want 0 without a baseline", got)
+	}
+
+	putEntry(t, m, pid32(999998), u64(1))
+	putEntry(t, m, pid32(999999), u64(1))
+	collectNow(t, c)
+	if got := gaugeValue(t, reg, "ebpf_map_entries_delta"); got != 2 {
+		t.Errorf("delta after two inserts = %v, want 2", got)
+	}
+
+	if err := m.Delete(pid32(999999)); err != nil {
+		t.Fatal(err)
+	}
+	collectNow(t, c)
+	if got := gaugeValue(t, reg, "ebpf_map_entries_delta"); got != -1 {
+		t.Errorf("delta after a delete = %v, want -1", got)
+	}
+
+	c.OnMapSwap()
+	collectNow(t, c)
+	if got := gaugeValue(t, reg, "ebpf_map_entries_delta"); got != 0 {
+		t.Errorf("delta after a map swap = %v, want 0", got)
+	}
+}
+
+func TestCollectorConnectThreshold(t *testing.T) {
+	c, reg := newTestCollector(t, Config{
+		CountsMap:        newCountsMap(t, map[uint32]uint64{999998: 4, 999999: 5}),
+		ConnectThreshold: 4,
+	})
+	collectNow(t, c)
+
+	f := gather(t, reg, "ebpf_pid_over_threshold")
+	if f == nil {
+		t.Fatal("ebpf_pid_over_threshold not gathered")
+	}
+	for pid, want := range map[string]float64{"999998": 0, "999999": 1} {
+		if s := findMetric(f, map[string]string{"pid": pid}); s == nil || s.GetGauge().GetValue() != want {
+			t.Errorf("pid %s: got %v, want %v", pid, s, want)
+		}
+	}
+}
+
+func TestCollectorSlowCollections(t *testing.T) {
+	var logs bytes.Buffer
+	c, reg := newTestCollector(t, Config{
+		CountsMap:               newCountsMap(t, nil),
+		SlowCollectionThreshold: time.Second,
+		Logger:                  slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+
+	c.checkSlow(time.Second, 10)
+	if logs.Len() != 0 {
+		t.Errorf("collection at the threshold logged %q", logs.String())
+	}
+	c.checkSlow(2*time.Second, 10)
+	if !strings.Contains(logs.String(), "Slow metrics collection") || !strings.Contains(logs.String(), "entries=10") {
+		t.Errorf("log = %q, want a slow collection warning with the entry count", logs.String())
+	}
+
+	f := gather(t, reg, "ebpf_slow_collections_total")
+	if f == nil || f.GetMetric()[0].GetCounter().GetValue() != 1 {
+		t.Fatalf("ebpf_slow_collections_total = %v, want 1", f)
+	}
+}
+
+func TestCollectorPullMode(t *testing.T) {
+	m := newCountsMap(t, map[uint32]uint64{selfPID: 1})
+	c, reg := newTestCollector(t, Config{CountsMap: m, PullMode: true, Interval: time.Millisecond})
+	c.Start()
+	t.Cleanup(c.Stop)
+
+	time.Sleep(20 * time.Millisecond)
+	if got := c.Status().LastCollection; !got.IsZero() {
+		t.Fatalf("PullMode collected in the background at %v", got)
+	}
+
+	g := c.CollectingGatherer(reg)
+	for _, want := range []float64{1, 7} {
+		putEntry(t, m, pid32(selfPID), u64(uint64(want)))
+		f := gather(t, g, "tcp_connects_by_pid")
+		if s := findMetric(f, map[string]string{"comm": "metrics.test"}); s == nil || s.GetGauge().GetValue() != want {
+			t.Fatalf("gather: got %v, want a fresh read of %v", s, want)
+		}
+	}
+}
+
+func TestCollectorCountsMapSource(t *testing.T) {
+	var current atomic.Pointer[ebpf.Map]
+	current.Store(newCountsMap(t, map[uint32]uint64{selfPID: 1}))
+	c, reg := newTestCollector(t, Config{CountsMapSource: current.Load})
+
+	collectNow(t, c)
+	current.Store(newCountsMap(t, map[uint32]uint64{selfPID: 5}))
+	collectNow(t, c)
+
+	f := gather(t, reg, "tcp_connects_by_pid")
+	if f == nil || len(f.GetMetric()) != 1 {
+		t.Fatalf("tcp_connects_by_pid = %v, want the series carried over to the new map", f)
+	}
+	if got := f.GetMetric()[0].GetGauge().GetValue(); got != 5 {
+		t.Fatalf("after the swap got %v, want the new map's 5", got)
+	}
+}
+
+func TestCollectorIterateRetries(t *testing.T) {
+	m := newCountsMap(t, map[uint32]uint64{selfPID: 1})
+	// failNext makes the next read find no map
+	var failNext bool
+	source := func() *ebpf.Map {
+		if failNext {
+			failNext = false
+			return nil
+		}
+		return m
+	}
+
+	c, _ := newTestCollector(t, Config{CountsMapSource: source})
+	failNext = true
+	if entries := collectNow(t, c); len(entries) != 1 {
+		t.Fatalf("entries = %+v, want the retried read", entries)
+	}
+
+	c, _ = newTestCollector(t, Config{CountsMapSource: source, IterateRetries: -1})
+	failNext = true
+	if _, err := c.CollectNow(); err == nil {
+		t.Fatal("CollectNow without retries hid the failed read")
+	}
+}
+
+// histogramCount returns the sample count of the single histogram named name in g
+func histogramCount(t *testing.T, g prometheus.Gatherer, name string) uint64 {
+	t.Helper()
+	f := gather(t, g, name)
+	if f == nil || len(f.GetMetric()) != 1 {
+		t.Fatalf("%s: got %v, want one histogram", name, f)
+	}
+	return f.GetMetric()[0].GetHistogram().GetSampleCount()
+}
+
+func TestCollectorPhaseDurations(t *testing.T) {
+	c, reg := newTestCollector(t, Config{CountsMap: newCountsMap(t, map[uint32]uint64{selfPID: 1})})
+	collectNow(t, c)
+	collectNow(t, c)
+	for _, name := range []string{"ebpf_map_read_duration_seconds", "ebpf_name_resolve_duration_seconds"} {
+		if got := histogramCount(t, reg, name); got != 2 {
+			t.Errorf("%s observed %d collections, want 2", name, got)
+		}
+	}
+}
+
+func TestCollectorObserveProcReads(t *testing.T) {
+	c, reg := newTestCollector(t, Config{
+		CountsMap:        newCountsMap(t, map[uint32]uint64{selfPID: 1, 999999: 1}),
+		ObserveProcReads: true,
+	})
+	collectNow(t, c)
+	if got := histogramCount(t, reg, "procfs_read_duration_seconds"); got != 2 {
+		t.Fatalf("procfs_read_duration_seconds observed %d reads, want one per PID", got)
+	}
+
+	c, reg = newTestCollector(t, Config{CountsMap: newCountsMap(t, map[uint32]uint64{selfPID: 1})})
+	collectNow(t, c)
+	if f := gather(t, reg, "procfs_read_duration_seconds"); f != nil {
+		t.Fatal("procfs_read_duration_seconds exported without ObserveProcReads")
+	}
+}
+
+func TestCollectorOnCollect(t *testing.T) {
+	var got [][]MapEntry
+	c, _ := newTestCollector(t, Config{
+		CountsMap: newCountsMap(t, map[uint32]uint64{selfPID: 2}),
+		OnCollect: func(entries []MapEntry) {
+			got = append(got, entries)
+			entries[0].Count = 99
+		},
+	})
+	collectNow(t, c)
+
+	if len(got) != 1 || len(got[0]) != 1 {
+		t.Fatalf("OnCollect received %+v, want one snapshot with one entry", got)
+	}
+	if snap := c.Snapshot(); snap[0].Count != 2 {
+		t.Fatalf("Snapshot count = %d after the callback changed its copy, want 2", snap[0].Count)
+	}
+}
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+// Direction values recorded by the program after the PID in the map key
+const (
+	directionEgress  = 1 // outbound connect()
+	directionIngress = 2 // inbound accept()
+)
+
+// directionLabel translates a raw direction value into a label value
+func directionLabel(v uint32) string {
+	switch v {
+	case directionEgress:
+		return "egress"
+	case directionIngress:
+		return "ingress"
+	default:
+		return "unknown"
+	}
+}
+
+// Address family values recorded by the program, as in linux/socket.h
+const (
+	familyINET  = 2  // AF_INET
+	familyINET6 = 10 // AF_INET6
+)
+
+// familyLabel translates a raw address family into a label value
+func familyLabel(v uint32) string {
+	switch v {
+	case familyINET:
+		return "ipv4"
+	case familyINET6:
+		return "ipv6"
+	default:
+		return "unknown"
+	}
+}
+
+// keySize returns the map key size in bytes for the configured layout
+func (c *Collector) keySize() int {
+	size := 4 // PID
+	if c.directionKey {
+		size += 4
+	}
+	if c.dportKey {
+		size += 4
+	}
+	if c.familyKey {
+		size += 4
+	}
+	return size
+}
+
+// valueSize returns the map value size in bytes for the configured layout
+func (c *Collector) valueSize() int {
+	size := c.decoder.Size()
+	if c.exemplars != nil {
+		size += 16 // trace ID
+	}
+	return size
+}
+
+// validateMap checks the map's key and value sizes match the configured layout,
+// catching drift between the BPF object and the collector before iterating
+func (c *Collector) validateMap(m *ebpf.Map) error {
+	if got, want := int(m.KeySize()), c.keySize(); got != want {
+		return fmt.Errorf("map %s has %d-byte keys but the collector decodes %d-byte keys; was the object rebuilt with a different key type?", m, got, want)
+	}
+	if got, want := int(m.ValueSize()), c.valueSize(); got != want {
+		return fmt.Errorf("map %s has %d-byte values but the collector decodes %d-byte values; was the object rebuilt with a different value type?", m, got, want)
+	}
+	return nil
+}
+
+// decodeEntry decodes a raw key/value pair according to the configured layout
+func (c *Collector) decodeEntry(key, value []byte) (MapEntry, error) {
+	if len(value) != c.valueSize() {
+		return MapEntry{}, fmt.Errorf("value is %d bytes, expected %d", len(value), c.valueSize())
+	}
+	e, err := c.decodeWith(c.decoder, key, value[:c.decoder.Size()])
+	if err != nil {
+		return MapEntry{}, err
+	}
+	if c.exemplars != nil {
+		e.TraceID = traceIDString(value[c.decoder.Size():])
+	}
+	return e, nil
+}
+
+// decodeWith decodes a key in the configured layout and a value with decoder
+func (c *Collector) decodeWith(decoder ValueDecoder, key, value []byte) (MapEntry, error) {
+	if len(key) != c.keySize() {
+		return MapEntry{}, fmt.Errorf("key is %d bytes, expected %d", len(key), c.keySize())
+	}
+
+	counters, err := decoder.Decode(value)
+	if err != nil {
+		return MapEntry{}, err
+	}
+
+	e := MapEntry{
+		PID:   binary.NativeEndian.Uint32(key[0:4]),
+		Count: counters[0],
+	}
+	if fields := decoder.Fields(); len(fields) > 1 || fields[0] != "" {
+		e.Values = make(map[string]uint64, len(fields))
+		for i, field := range fields {
+			e.Values[field] = counters[i]
+		}
+	}
+	off := 4
+	if c.directionKey {
+		e.Direction = directionLabel(binary.NativeEndian.Uint32(key[off : off+4]))
+		off += 4
+	}
+	if c.dportKey {
+		e.Dport = binary.BigEndian.Uint16(key[off : off+2])
+		off += 4
+	}
+	if c.familyKey {
+		e.Family = familyLabel(binary.NativeEndian.Uint32(key[off : off+4]))
+	}
+	return e, nil
+}
+
+// traceIDString returns the hex trace ID, or "" when none was recorded
+func traceIDString(id []byte) string {
+	for _, b := range id {
+		if b != 0 {
+			return hex.EncodeToString(id)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewCollectorRejectsWideKeys(t *testing.T) {
+	m := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 8, ValueSize: 8})
+	_, err := NewCollector(Config{CountsMap: m, Registerer: prometheus.NewRegistry()})
+	if err == nil {
+		t.Fatal("NewCollector accepted a map with 8-byte keys for a uint32 PID decoder")
+	}
+	if !strings.Contains(err.Error(), "8-byte keys") || !strings.Contains(err.Error(), "4-byte keys") {
+		t.Fatalf("NewCollector error = %q, want it to name both key sizes", err)
+	}
+}
+
+// keyWith encodes a PID key followed by a uint32 field
+func keyWith(pid, field uint32) []byte {
+	return append(pid32(pid), pid32(field)...)
+}
+
+func TestCollectorDirectionKey(t *testing.T) {
+	m := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 8, ValueSize: 8})
+	putEntry(t, m, keyWith(selfPID, directionEgress), u64(3))
+	putEntry(t, m, keyWith(selfPID, directionIngress), u64(5))
+	putEntry(t, m, keyWith(selfPID, 9), u64(1))
+
+	reg := prometheus.NewRegistry()
+	c, err := NewCollector(Config{CountsMap: m, Registerer: reg, DirectionKey: true})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+
+	f := gather(t, reg, "tcp_connects_by_pid")
+	for direction, want := range map[string]float64{"egress": 3, "ingress": 5, "unknown": 1} {
+		if s := findMetric(f, map[string]string{"direction": direction}); s == nil || s.GetGauge().GetValue() != want {
+			t.Errorf("direction %s: got %v, want %v", direction, s, want)
+		}
+	}
+}
+
+func TestCollectorFamilyKey(t *testing.T) {
+	m := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 8, ValueSize: 8})
+	putEntry(t, m, keyWith(selfPID, familyINET), u64(4))
+	putEntry(t, m, keyWith(selfPID, familyINET6), u64(2))
+
+	reg := prometheus.NewRegistry()
+	c, err := NewCollector(Config{CountsMap: m, Registerer: reg, FamilyKey: true})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	entries, err := c.CollectNow()
+	if err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v, want one per family", entries)
+	}
+
+	f := gather(t, reg, "tcp_connects_by_pid")
+	for family, want := range map[string]float64{"ipv4": 4, "ipv6": 2} {
+		if s := findMetric(f, map[string]string{"family": family}); s == nil || s.GetGauge().GetValue() != want {
+			t.Errorf("family %s: got %v, want %v", family, s, want)
+		}
+	}
+}
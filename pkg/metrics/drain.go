@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+// drainEntries reads and removes every entry of the map. Keys are listed
+// first and each is then removed with LookupAndDelete, which is atomic in
+// the kernel, so an increment racing with the read either lands in the
+// value returned now or recreates the entry for the next collection.
+// An error stops the drain: the entries removed so far are returned with
+// it, since they are no longer in the map, and the rest stay for the next
+// collection.
+func (c *Collector) drainEntries(ctx context.Context, m *ebpf.Map) ([]MapEntry, error) {
+	var keys [][]byte
+	iter := m.Iterate()
+	var key, value []byte
+	for iter.Next(&key, &value) {
+		keys = append(keys, append([]byte(nil), key...))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("iterate map: %w", err)
+	}
+
+	entries := make([]MapEntry, 0, len(keys))
+	for _, k := range keys {
+		if ctx.Err() != nil {
+			break
+		}
+		var v []byte
+		if err := m.LookupAndDelete(k, &v); err != nil {
+			if errors.Is(err, ebpf.ErrKeyNotExist) {
+				continue
+			}
+			return drained(entries), fmt.Errorf("lookup and delete: %w", err)
+		}
+		e, err := c.decodeEntry(k, v)
+		if err != nil {
+			return drained(entries), fmt.Errorf("decode entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// drained returns the entries removed before a failed drain, or nil if
+// there are none so the read can be retried
+func drained(entries []MapEntry) []MapEntry {
+	if len(entries) == 0 {
+		return nil
+	}
+	return entries
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// failingDecoder decodes uint64 counts but rejects the value bad
+type failingDecoder struct {
+	Uint64Decoder
+	bad uint64
+}
+
+func (d failingDecoder) Decode(value []byte) ([]uint64, error) {
+	if binary.NativeEndian.Uint64(value) == d.bad {
+		return nil, fmt.Errorf("bad value")
+	}
+	return d.Uint64Decoder.Decode(value)
+}
+
+// mapLen returns the number of entries in m
+func mapLen(t *testing.T, m *ebpf.Map) int {
+	t.Helper()
+	n := 0
+	var key, value []byte
+	iter := m.Iterate()
+	for iter.Next(&key, &value) {
+		n++
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("iterate: %v", err)
+	}
+	return n
+}
+
+func TestCollectorReadAndClear(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newCountsMap(t, map[uint32]uint64{1: 4, 2: 6})
+	c, err := NewCollector(Config{CountsMap: m, Registerer: reg, ReadAndClear: true})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+
+	entries, err := c.CollectNow()
+	if err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if n := mapLen(t, m); n != 0 {
+		t.Errorf("map holds %d entries after a drain, want 0", n)
+	}
+
+	putEntry(t, m, pid32(1), u64(1))
+	entries, err = c.CollectNow()
+	if err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Count != 1 {
+		t.Errorf("second drain = %+v, want only the delta of pid 1", entries)
+	}
+}
+
+func TestCollectorReadAndClearPartial(t *testing.T) {
+	const total = 16
+	counts := make(map[uint32]uint64, total)
+	for pid := uint32(1); pid <= total; pid++ {
+		counts[pid] = uint64(pid)
+	}
+	m := newCountsMap(t, counts)
+	c, err := NewCollector(Config{
+		CountsMap:    m,
+		Registerer:   prometheus.NewRegistry(),
+		ReadAndClear: true,
+		ValueDecoder: failingDecoder{bad: 8},
+		// A retry would drain the rest and hide the partial result
+		IterateRetries: -1,
+	})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+
+	entries, err := c.CollectNow()
+	if err == nil {
+		t.Fatal("CollectNow succeeded with an undecodable value")
+	}
+	// Everything removed from the map except the bad value is returned
+	if got := len(entries) + 1 + mapLen(t, m); got != total {
+		t.Errorf("%d entries returned + 1 bad + %d left = %d, want %d", len(entries), mapLen(t, m), got, total)
+	}
+	if len(entries) > 0 && len(c.Snapshot()) != len(entries) {
+		t.Errorf("snapshot holds %d entries, want the %d drained", len(c.Snapshot()), len(entries))
+	}
+}
+
+func TestReadAndClearRejectsAggregate(t *testing.T) {
+	_, err := NewCollector(Config{Registerer: prometheus.NewRegistry(), ReadAndClear: true, Aggregate: true})
+	if err == nil {
+		t.Fatal("NewCollector accepted ReadAndClear with Aggregate")
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// exemplarSample is a single per-PID series with its optional trace ID
+type exemplarSample struct {
+	labelValues []string
+	count       uint64
+	traceID     string
+}
+
+// exemplarCollector exports per-PID counts with OpenMetrics exemplars.
+// GaugeVec cannot carry exemplars, so the series are emitted as const
+// counter metrics built from the latest snapshot.
+type exemplarCollector struct {
+	desc  *prometheus.Desc
+	label string
+
+	mu      sync.RWMutex
+	samples []exemplarSample
+}
+
+// newExemplarCollector creates a collector attaching the trace ID under label
+func newExemplarCollector(label string, labelNames []string, constLabels prometheus.Labels) *exemplarCollector {
+	return &exemplarCollector{
+		desc: prometheus.NewDesc(
+			"tcp_connects_by_pid_total",
+			"Number of tcp_connect() calls observed per PID, with trace exemplars",
+			labelNames,
+			constLabels,
+		),
+		label: label,
+	}
+}
+
+// update replaces the snapshot exported on the next scrape
+func (e *exemplarCollector) update(samples []exemplarSample) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.samples = samples
+}
+
+// Describe implements prometheus.Collector
+func (e *exemplarCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.desc
+}
+
+// Collect implements prometheus.Collector
+func (e *exemplarCollector) Collect(ch chan<- prometheus.Metric) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, s := range e.samples {
+		m, err := prometheus.NewConstMetric(e.desc, prometheus.CounterValue, float64(s.count), s.labelValues...)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(e.desc, err)
+			continue
+		}
+
+		if s.traceID != "" {
+			// The exemplar represents the single most recent connect
+			withExemplar, err := prometheus.NewMetricWithExemplars(m, prometheus.Exemplar{
+				Value:  1,
+				Labels: prometheus.Labels{e.label: s.traceID},
+			})
+			if err == nil {
+				m = withExemplar
+			}
+		}
+
+		ch <- m
+	}
+}
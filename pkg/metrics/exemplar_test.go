@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestExemplarInOpenMetrics(t *testing.T) {
+	e := newExemplarCollector("trace_id", []string{"pid", "comm"}, nil)
+	e.update([]exemplarSample{
+		{labelValues: []string{"42", "curl"}, count: 3, traceID: "4bf92f3577b34da6"},
+		{labelValues: []string{"43", "wget"}, count: 1},
+	})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e)
+
+	srv := httptest.NewServer(promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+	defer srv.Close()
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	var withExemplar, without string
+	for _, line := range strings.Split(string(body), "\n") {
+		switch {
+		case strings.Contains(line, `pid="42"`):
+			withExemplar = line
+		case strings.Contains(line, `pid="43"`):
+			without = line
+		}
+	}
+	if !strings.Contains(withExemplar, `# {trace_id="4bf92f3577b34da6"} 1`) {
+		t.Fatalf("series for pid 42 has no trace exemplar: %q\n%s", withExemplar, body)
+	}
+	if without == "" || strings.Contains(without, "#") {
+		t.Fatalf("series for pid 43 = %q, want it without an exemplar", without)
+	}
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteCSV writes entries as pid,comm,count rows with a header row
+func WriteCSV(w io.Writer, entries []MapEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"pid", "comm", "count"}); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		row := []string{
+			e.pidLabel(),
+			e.Comm,
+			strconv.FormatUint(e.Count, 10),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteTable writes entries as an aligned PID/COMM/COUNT table followed by a blank line
+func WriteTable(w io.Writer, entries []MapEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "PID\tCOMM\tCOUNT")
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\n", e.pidLabel(), e.Comm, e.Count)
+	}
+	_, _ = fmt.Fprintln(tw)
+	return tw.Flush()
+}
+
+// ExportCSV writes the latest collected snapshot as CSV
+func (c *Collector) ExportCSV(w io.Writer) error {
+	return WriteCSV(w, c.Snapshot())
+}
+
+// CSVHandler serves the latest snapshot as a CSV download
+func (c *Collector) CSVHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="counts.csv"`)
+	if err := c.ExportCSV(w); err != nil {
+		// Headers are already sent, so all we can do is log
+		log.Printf("Failed to write counts CSV: %v", err)
+	}
+}
+
+// CountsHandler serves the latest snapshot as JSON. The comm and pid query
+// parameters filter it to matching entries; an invalid pid is a 400.
+func (c *Collector) CountsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	entries := c.Snapshot()
+
+	if raw := query.Get("pid"); raw != "" {
+		pid, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid pid %q: must be a non-negative integer", raw), http.StatusBadRequest)
+			return
+		}
+		entries = filterEntries(entries, func(e MapEntry) bool { return e.PID == uint32(pid) })
+	}
+	if comm := query.Get("comm"); comm != "" {
+		entries = filterEntries(entries, func(e MapEntry) bool { return e.Comm == comm })
+	}
+
+	body, err := json.Marshal(entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(body, '\n'))
+}
+
+// CollectResult is the response of CollectHandler
+type CollectResult struct {
+	Entries         []MapEntry `json:"entries"`
+	DurationSeconds float64    `json:"duration_seconds"`
+	// Error reports a failure that didn't stop the counts map from being
+	// collected, such as a failed extra map
+	Error string `json:"error,omitempty"`
+}
+
+// CollectHandler runs a collection on POST and serves its entries and
+// duration as JSON, to exercise the collection path without waiting for
+// the next interval. Failing to read the counts map is a 500; other
+// failures are reported in the result's error.
+func (c *Collector) CollectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	start := time.Now()
+	entries, err := c.CollectNow()
+	took := time.Since(start)
+	if err != nil && entries == nil {
+		http.Error(w, fmt.Sprintf("collect: %v", err), http.StatusInternalServerError)
+		return
+	}
+	result := CollectResult{Entries: entries, DurationSeconds: took.Seconds()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(body, '\n'))
+}
+
+// filterEntries returns the entries for which keep is true
+func filterEntries(entries []MapEntry, keep func(MapEntry) bool) []MapEntry {
+	out := make([]MapEntry, 0, len(entries))
+	for _, e := range entries {
+		if keep(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the collection goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWriteTable(t *testing.T) {
+	var buf bytes.Buffer
+	entries := []MapEntry{
+		{PID: 1, Comm: "init", Count: 12},
+		{Comm: "curl", Count: 3, Aggregated: true},
+	}
+	if err := WriteTable(&buf, entries); err != nil {
+		t.Fatalf("WriteTable: %v", err)
+	}
+	want := "PID         COMM  COUNT\n" +
+		"1           init  12\n" +
+		"aggregated  curl  3\n" +
+		"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("table =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCollectorStdoutTable(t *testing.T) {
+	var out syncBuffer
+	m := newCountsMap(t, map[uint32]uint64{selfPID: 7})
+	_, clock, collected := startWithClock(t, Config{
+		CountsMap:   m,
+		Interval:    time.Second,
+		Registerer:  prometheus.NewRegistry(),
+		StdoutTable: true,
+		TableWriter: &out,
+	})
+	clock.waitTickers(t, 1)
+	clock.Advance(time.Second)
+	expectCollection(t, collected)
+
+	// The table is written after OnCollect returns
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), "metrics.test") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := out.String(); !strings.HasPrefix(got, "PID") || !strings.Contains(got, "metrics.test") {
+		t.Errorf("table output = %q, want a header and the test process", got)
+	}
+}
+
+func TestCollectHandler(t *testing.T) {
+	m := newCountsMap(t, map[uint32]uint64{selfPID: 2})
+	broken := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: 8})
+	broken.Close()
+
+	newCollector := func(t *testing.T, cfg Config) *Collector {
+		t.Helper()
+		cfg.Registerer = prometheus.NewRegistry()
+		cfg.IterateRetries = -1
+		c, err := NewCollector(cfg)
+		if err != nil {
+			t.Fatalf("NewCollector: %v", err)
+		}
+		return c
+	}
+	post := func(c *Collector) (*httptest.ResponseRecorder, CollectResult) {
+		rec := httptest.NewRecorder()
+		c.CollectHandler(rec, httptest.NewRequest(http.MethodPost, "/debug/collect", nil))
+		var result CollectResult
+		_ = json.Unmarshal(rec.Body.Bytes(), &result)
+		return rec, result
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		rec, result := post(newCollector(t, Config{CountsMap: m}))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+		if len(result.Entries) != 1 || result.Entries[0].Count != 2 || result.Error != "" {
+			t.Errorf("result = %+v, want one entry counting 2", result)
+		}
+	})
+
+	t.Run("extra map fails", func(t *testing.T) {
+		c := newCollector(t, Config{
+			CountsMap: m,
+			ExtraMaps: []MapMetric{{Name: "bytes", Source: func() *ebpf.Map { return broken }}},
+		})
+		rec, result := post(c)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+		if len(result.Entries) != 1 || result.Error == "" {
+			t.Errorf("result = %+v, want the counts entry and the extra map error", result)
+		}
+	})
+
+	t.Run("counts map fails", func(t *testing.T) {
+		rec, _ := post(newCollector(t, Config{CountsMapSource: func() *ebpf.Map { return nil }}))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want 500", rec.Code)
+		}
+	})
+
+	t.Run("GET", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newCollector(t, Config{CountsMap: m}).CollectHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/collect", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("status = %d, want 405", rec.Code)
+		}
+	})
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	entries := []MapEntry{
+		{PID: 42, Comm: "curl", Count: 3},
+		{Comm: "a,b", Count: 9, Aggregated: true},
+	}
+	if err := WriteCSV(&buf, entries); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	want := "pid,comm,count\n42,curl,3\naggregated,\"a,b\",9\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("WriteCSV =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCSVHandler(t *testing.T) {
+	c, err := NewCollector(Config{CountsMap: newCountsMap(t, map[uint32]uint64{selfPID: 2}), Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	c.CSVHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/counts.csv", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type = %q, want text/csv", ct)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("Content-Disposition = %q, want an attachment", rec.Header().Get("Content-Disposition"))
+	}
+	if !strings.Contains(rec.Body.String(), ",metrics.test,2\n") {
+		t.Errorf("body = %q, want the collected entry", rec.Body.String())
+	}
+}
+
+func TestCountsHandlerFilters(t *testing.T) {
+	c, err := NewCollector(Config{CountsMap: newCountsMap(t, map[uint32]uint64{selfPID: 2, 999999: 5}), Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	get := func(query string) (*httptest.ResponseRecorder, []MapEntry) {
+		rec := httptest.NewRecorder()
+		c.CountsHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/counts"+query, nil))
+		var entries []MapEntry
+		_ = json.Unmarshal(rec.Body.Bytes(), &entries)
+		return rec, entries
+	}
+
+	if _, entries := get(""); len(entries) != 2 {
+		t.Errorf("unfiltered: %d entries, want 2", len(entries))
+	}
+	if _, entries := get("?comm=metrics.test"); len(entries) != 1 || entries[0].PID != selfPID {
+		t.Errorf("comm filter: %+v, want this process only", entries)
+	}
+	if _, entries := get("?pid=999999"); len(entries) != 1 || entries[0].Count != 5 {
+		t.Errorf("pid filter: %+v, want pid 999999 only", entries)
+	}
+	if _, entries := get("?pid=999999&comm=metrics.test"); len(entries) != 0 {
+		t.Errorf("combined filters: %+v, want none", entries)
+	}
+	if rec, _ := get("?pid=-1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid pid: status %d, want 400", rec.Code)
+	}
+}
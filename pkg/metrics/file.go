@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// WriteToFile writes the gathered metrics to path in text exposition format.
+// The file is written to a temporary file and renamed into place so readers
+// never observe a partial snapshot.
+func WriteToFile(path string, gatherer prometheus.Gatherer) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("gather: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer func() {
+		// Clean up on failure; after a successful rename this is a no-op
+		_ = os.Remove(tmp.Name())
+	}()
+
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(tmp, mf); err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("encode %s: %w", mf.GetName(), err)
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("chmod temp file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename into place: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWriteToFile(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_value", Help: "test"})
+	reg.MustRegister(g)
+	g.Set(3)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.prom")
+	if err := WriteToFile(path, reg); err != nil {
+		t.Fatalf("WriteToFile: %v", err)
+	}
+	g.Set(4)
+	if err := WriteToFile(path, reg); err != nil {
+		t.Fatalf("second WriteToFile: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "test_value 4\n") {
+		t.Fatalf("file = %q, want the latest snapshot", data)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o644 {
+		t.Fatalf("mode = %v, %v, want 0644", info.Mode().Perm(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("dir holds %d files, want no temporary files left behind", len(entries))
+	}
+
+	if err := WriteToFile(filepath.Join(dir, "missing", "metrics.prom"), reg); err == nil {
+		t.Fatal("WriteToFile into a missing directory returned no error")
+	}
+}
@@ -0,0 +1,50 @@
+package metrics
+
+// commFilter selects entries by process name
+type commFilter struct {
+	allow map[string]struct{}
+	deny  map[string]struct{}
+}
+
+// newCommFilter builds a filter from the allow and deny lists, or returns
+// nil when both are empty
+func newCommFilter(allow, deny []string) *commFilter {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil
+	}
+	return &commFilter{allow: stringSet(allow), deny: stringSet(deny)}
+}
+
+// stringSet returns the values as a set, or nil when there are none
+func stringSet(values []string) map[string]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
+
+// keep applies the allowlist first, then removes anything on the denylist
+func (f *commFilter) keep(comm string) bool {
+	if f.allow != nil {
+		if _, ok := f.allow[comm]; !ok {
+			return false
+		}
+	}
+	_, denied := f.deny[comm]
+	return !denied
+}
+
+// apply filters entries in place and returns the kept ones
+func (f *commFilter) apply(entries []MapEntry) []MapEntry {
+	kept := entries[:0]
+	for _, e := range entries {
+		if f.keep(e.Comm) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCommFilter(t *testing.T) {
+	if newCommFilter(nil, nil) != nil {
+		t.Fatal("empty lists built a filter")
+	}
+
+	f := newCommFilter([]string{"nginx", "curl"}, []string{"curl", "sshd"})
+	for comm, want := range map[string]bool{"nginx": true, "curl": false, "sshd": false, "bash": false} {
+		if got := f.keep(comm); got != want {
+			t.Errorf("keep(%q) = %v, want %v with the denylist applied after the allowlist", comm, got, want)
+		}
+	}
+
+	denyOnly := newCommFilter(nil, []string{"sshd"})
+	kept := denyOnly.apply([]MapEntry{{PID: 1, Comm: "sshd"}, {PID: 2, Comm: "bash"}, {PID: 3, Comm: "sshd"}})
+	if len(kept) != 1 || kept[0].PID != 2 {
+		t.Errorf("apply = %+v, want only pid 2", kept)
+	}
+}
+
+func TestCollectorCommDenylist(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newCountsMap(t, map[uint32]uint64{selfPID: 3, 999999: 5})
+	c, err := NewCollector(Config{CountsMap: m, Registerer: reg, CommDenylist: []string{"metrics.test"}})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+
+	f := gather(t, reg, "tcp_connects_by_pid")
+	if f == nil || len(f.GetMetric()) != 1 || findMetric(f, map[string]string{"pid": "999999"}) == nil {
+		t.Fatalf("tcp_connects_by_pid = %v, want only the PID not on the denylist", f)
+	}
+}
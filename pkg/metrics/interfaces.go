@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InterfaceConfig holds the configuration for the per-interface collector
+type InterfaceConfig struct {
+	// StatsMap is keyed by uint32 ifindex with a uint64 packet count value
+	StatsMap *ebpf.Map
+	Interval time.Duration
+	OnError  func(error)
+	Clock    Clock
+
+	// NameTTL is how long a resolved interface name is trusted before it is
+	// looked up again, so renames and reused ifindexes are picked up;
+	// defaults to one minute
+	NameTTL time.Duration
+
+	// Registerer receives the metrics; defaults to the Prometheus default registerer
+	Registerer prometheus.Registerer
+}
+
+// InterfaceCollector exports per-interface packet counts from an XDP stats map
+type InterfaceCollector struct {
+	statsMap *ebpf.Map
+	gauge    *prometheus.GaugeVec
+	resolver *ifaceResolver
+	labels   map[uint32]string
+	interval time.Duration
+	clock    Clock
+	stopChan chan struct{}
+	onError  func(error)
+}
+
+// NewInterfaceCollector creates a new per-interface collector. It returns an
+// error if its metric conflicts with one already registered.
+func NewInterfaceCollector(cfg InterfaceConfig) (*InterfaceCollector, error) {
+	gauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xdp_packets_by_interface",
+			Help: "Number of packets observed by the XDP program per interface",
+		},
+		[]string{"interface"},
+	)
+	if cfg.Registerer == nil {
+		cfg.Registerer = prometheus.DefaultRegisterer
+	}
+	if err := registerAll(cfg.Registerer, gauge); err != nil {
+		return nil, err
+	}
+
+	if cfg.Interval == 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = realClock{}
+	}
+	if cfg.NameTTL == 0 {
+		cfg.NameTTL = time.Minute
+	}
+
+	return &InterfaceCollector{
+		statsMap: cfg.StatsMap,
+		gauge:    gauge,
+		resolver: newIfaceResolver(net.InterfaceByIndex, cfg.Clock, cfg.NameTTL),
+		labels:   make(map[uint32]string),
+		interval: cfg.Interval,
+		clock:    cfg.Clock,
+		stopChan: make(chan struct{}),
+		onError:  cfg.OnError,
+	}, nil
+}
+
+// Start begins collecting metrics
+func (c *InterfaceCollector) Start() {
+	go func() {
+		ticker := c.clock.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C():
+				if err := c.collect(); err != nil && c.onError != nil {
+					c.onError(err)
+				}
+			case <-c.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the metrics collection
+func (c *InterfaceCollector) Stop() {
+	close(c.stopChan)
+}
+
+// collect reads the stats map and updates the per-interface gauges. When an
+// ifindex resolves to a different name than before, the series under the
+// old name is deleted so it doesn't linger with a stale count.
+func (c *InterfaceCollector) collect() error {
+	iter := c.statsMap.Iterate()
+
+	var ifindex uint32
+	var packets uint64
+	for iter.Next(&ifindex, &packets) {
+		name := c.resolver.name(ifindex)
+		if old, ok := c.labels[ifindex]; ok && old != name {
+			c.gauge.DeleteLabelValues(old)
+		}
+		c.labels[ifindex] = name
+		c.gauge.WithLabelValues(name).Set(float64(packets))
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("iterate map: %w", err)
+	}
+	return nil
+}
+
+// ifaceResolver maps ifindex to interface name, caching successful lookups
+// for ttl
+type ifaceResolver struct {
+	lookup func(int) (*net.Interface, error)
+	clock  Clock
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	names map[uint32]ifaceName
+}
+
+// ifaceName is a cached lookup result
+type ifaceName struct {
+	name    string
+	expires time.Time
+}
+
+func newIfaceResolver(lookup func(int) (*net.Interface, error), clock Clock, ttl time.Duration) *ifaceResolver {
+	return &ifaceResolver{
+		lookup: lookup,
+		clock:  clock,
+		ttl:    ttl,
+		names:  make(map[uint32]ifaceName),
+	}
+}
+
+// name returns the interface name for ifindex. Interfaces that can't be
+// resolved (e.g. already removed) are labeled with the raw ifindex and
+// not cached, so a later lookup can still succeed. Cached names are looked
+// up again once they expire, so a renamed interface or a reused ifindex
+// doesn't keep the old name.
+func (r *ifaceResolver) name(ifindex uint32) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	if cached, ok := r.names[ifindex]; ok && now.Before(cached.expires) {
+		return cached.name
+	}
+
+	iface, err := r.lookup(int(ifindex))
+	if err != nil {
+		delete(r.names, ifindex)
+		return strconv.FormatUint(uint64(ifindex), 10)
+	}
+
+	r.names[ifindex] = ifaceName{name: iface.Name, expires: now.Add(r.ttl)}
+	return iface.Name
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeInterfaces returns a lookup over up, counting the calls
+func fakeInterfaces(up map[int]string, lookups *int) func(int) (*net.Interface, error) {
+	return func(index int) (*net.Interface, error) {
+		*lookups++
+		name, ok := up[index]
+		if !ok {
+			return nil, errors.New("no such network interface")
+		}
+		return &net.Interface{Index: index, Name: name}, nil
+	}
+}
+
+func TestIfaceResolver(t *testing.T) {
+	lookups := 0
+	up := map[int]string{1: "lo", 2: "eth0"}
+	r := newIfaceResolver(fakeInterfaces(up, &lookups), realClock{}, time.Minute)
+
+	if got := r.name(2); got != "eth0" {
+		t.Errorf("name(2) = %q, want eth0", got)
+	}
+	r.name(2)
+	if lookups != 1 {
+		t.Errorf("lookups = %d, want the second call served from the cache", lookups)
+	}
+
+	if got := r.name(7); got != "7" {
+		t.Errorf("name(7) = %q, want the raw ifindex", got)
+	}
+	up[7] = "veth7"
+	if got := r.name(7); got != "veth7" {
+		t.Errorf("name(7) after the interface appeared = %q, want veth7", got)
+	}
+}
+
+func TestIfaceResolverExpiry(t *testing.T) {
+	lookups := 0
+	up := map[int]string{2: "eth0"}
+	clock := newFakeClock(time.Unix(0, 0))
+	r := newIfaceResolver(fakeInterfaces(up, &lookups), clock, time.Minute)
+
+	r.name(2)
+	up[2] = "eth1"
+	clock.Advance(30 * time.Second)
+	if got := r.name(2); got != "eth0" {
+		t.Errorf("name(2) before the TTL = %q, want the cached eth0", got)
+	}
+	clock.Advance(30 * time.Second)
+	if got := r.name(2); got != "eth1" {
+		t.Errorf("name(2) after the TTL = %q, want the renamed eth1", got)
+	}
+	if lookups != 2 {
+		t.Errorf("lookups = %d, want one per TTL", lookups)
+	}
+
+	delete(up, 2)
+	clock.Advance(time.Minute)
+	if got := r.name(2); got != "2" {
+		t.Errorf("name(2) after removal = %q, want the raw ifindex", got)
+	}
+}
+
+func TestInterfaceCollectorRename(t *testing.T) {
+	m := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: 8})
+	putEntry(t, m, pid32(2), u64(10))
+
+	reg := prometheus.NewRegistry()
+	clock := newFakeClock(time.Unix(0, 0))
+	c, err := NewInterfaceCollector(InterfaceConfig{StatsMap: m, Registerer: reg, Clock: clock})
+	if err != nil {
+		t.Fatalf("NewInterfaceCollector: %v", err)
+	}
+	lookups := 0
+	up := map[int]string{2: "eth0"}
+	c.resolver = newIfaceResolver(fakeInterfaces(up, &lookups), clock, time.Minute)
+	if err := c.collect(); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	up[2] = "eth1"
+	clock.Advance(time.Minute)
+	if err := c.collect(); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	f := gather(t, reg, "xdp_packets_by_interface")
+	if s := findMetric(f, map[string]string{"interface": "eth1"}); s == nil || s.GetGauge().GetValue() != 10 {
+		t.Errorf("eth1: got %v, want 10", s)
+	}
+	if s := findMetric(f, map[string]string{"interface": "eth0"}); s != nil {
+		t.Errorf("eth0 series kept after the rename: %v", s)
+	}
+}
+
+func TestInterfaceCollector(t *testing.T) {
+	m := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: 8})
+	putEntry(t, m, pid32(1), u64(10))
+	putEntry(t, m, pid32(4242), u64(3))
+
+	reg := prometheus.NewRegistry()
+	c, err := NewInterfaceCollector(InterfaceConfig{StatsMap: m, Registerer: reg})
+	if err != nil {
+		t.Fatalf("NewInterfaceCollector: %v", err)
+	}
+	lookups := 0
+	c.resolver = newIfaceResolver(fakeInterfaces(map[int]string{1: "lo"}, &lookups), realClock{}, time.Minute)
+	if err := c.collect(); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	f := gather(t, reg, "xdp_packets_by_interface")
+	if f == nil {
+		t.Fatal("xdp_packets_by_interface not gathered")
+	}
+	for iface, want := range map[string]float64{"lo": 10, "4242": 3} {
+		if s := findMetric(f, map[string]string{"interface": iface}); s == nil || s.GetGauge().GetValue() != want {
+			t.Errorf("interface %s: got %v, want %v", iface, s, want)
+		}
+	}
+
+	if _, err := NewInterfaceCollector(InterfaceConfig{StatsMap: m, Registerer: reg}); err == nil {
+		t.Error("second collector on the same registry registered without an error")
+	}
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LoadMetrics records eBPF load and attach durations. Histograms keep their
+// observations while unregistered, so loads that happen before the registry
+// is set up are published once Register is called.
+type LoadMetrics struct {
+	load   prometheus.Histogram
+	attach prometheus.Histogram
+}
+
+// NewLoadMetrics creates unregistered load and attach duration histograms
+func NewLoadMetrics() *LoadMetrics {
+	return &LoadMetrics{
+		load: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "ebpf_load_duration_seconds",
+			Help:    "Time taken to load the eBPF object spec and create its collection",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+		}),
+		attach: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "ebpf_attach_duration_seconds",
+			Help:    "Time taken to attach the eBPF program",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+		}),
+	}
+}
+
+// Observe records one load, e.g. as ebpf.Config.OnLoad
+func (l *LoadMetrics) Observe(load, attach time.Duration) {
+	l.load.Observe(load.Seconds())
+	l.attach.Observe(attach.Seconds())
+}
+
+// Register exports the histograms on reg, including earlier observations
+func (l *LoadMetrics) Register(reg prometheus.Registerer) error {
+	return registerAll(reg, l.load, l.attach)
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLoadMetricsObservedBeforeRegister(t *testing.T) {
+	l := NewLoadMetrics()
+	l.Observe(300*time.Millisecond, 20*time.Millisecond)
+
+	reg := prometheus.NewRegistry()
+	if err := l.Register(reg); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	for name, want := range map[string]float64{"ebpf_load_duration_seconds": 0.3, "ebpf_attach_duration_seconds": 0.02} {
+		f := gather(t, reg, name)
+		if f == nil {
+			t.Fatalf("%s not gathered", name)
+		}
+		h := f.GetMetric()[0].GetHistogram()
+		if h.GetSampleCount() != 1 || h.GetSampleSum() != want {
+			t.Errorf("%s: count %d sum %v, want the earlier observation %v", name, h.GetSampleCount(), h.GetSampleSum(), want)
+		}
+	}
+
+	if err := l.Register(prometheus.NewRegistry()); err != nil {
+		t.Fatalf("Register on a second registry: %v", err)
+	}
+	if err := l.Register(reg); err == nil {
+		t.Fatal("registering twice on the same registry returned no error")
+	}
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rogerwesterbo/ebpf-testing/internal/procfs"
+)
+
+// MapMetric describes an additional PID-keyed map read by the collector,
+// such as per-PID bytes or errors, exported with the same labels as the
+// counts map
+type MapMetric struct {
+	// Source returns the current map on every collection
+	Source func() *ebpf.Map
+	// Name is the metric name; multi-field decoders export Name_<field>
+	Name string
+	Help string
+	// ValueDecoder decodes the map values; defaults to a single uint64
+	ValueDecoder ValueDecoder
+}
+
+// extraMap is a registered MapMetric with its gauges
+type extraMap struct {
+	name    string
+	source  func() *ebpf.Map
+	decoder ValueDecoder
+	gauges  []*prometheus.GaugeVec
+	fields  []string
+	series  map[string]*seriesState
+}
+
+// newExtraMap creates the gauges for a MapMetric
+func newExtraMap(mm MapMetric, labelNames []string, constLabels prometheus.Labels) (*extraMap, error) {
+	if mm.Name == "" || mm.Source == nil {
+		return nil, fmt.Errorf("map metric needs a Name and a Source")
+	}
+	if mm.ValueDecoder == nil {
+		mm.ValueDecoder = Uint64Decoder{}
+	} else if err := validateDecoder(mm.ValueDecoder); err != nil {
+		return nil, fmt.Errorf("map metric %s: %w", mm.Name, err)
+	}
+	if mm.Help == "" {
+		mm.Help = fmt.Sprintf("Per-PID %s read from the eBPF map", mm.Name)
+	}
+
+	x := &extraMap{
+		name:    mm.Name,
+		source:  mm.Source,
+		decoder: mm.ValueDecoder,
+		fields:  mm.ValueDecoder.Fields(),
+		series:  make(map[string]*seriesState),
+	}
+	for _, field := range x.fields {
+		x.gauges = append(x.gauges, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        metricName(mm.Name, field),
+				Help:        mm.Help,
+				ConstLabels: constLabels,
+			},
+			labelNames,
+		))
+	}
+	return x, nil
+}
+
+// processes returns the resolved process of each PID of entries, for
+// labeling the extra maps without reading /proc again. It is nil without
+// extra maps.
+func (c *Collector) processes(entries []MapEntry) map[uint32]MapEntry {
+	if len(c.extraMaps) == 0 {
+		return nil
+	}
+	known := make(map[uint32]MapEntry, len(entries))
+	for _, e := range entries {
+		known[e.PID] = MapEntry{Comm: e.Comm, PodUID: e.PodUID, ContainerID: e.ContainerID}
+	}
+	return known
+}
+
+// collectExtraMaps reads every additional map and publishes it. PIDs of the
+// counts map keep its names and pod labels; known is extended with the
+// PIDs only found in the extra maps.
+func (c *Collector) collectExtraMaps(ctx context.Context, known map[uint32]MapEntry) error {
+	for _, x := range c.extraMaps {
+		if err := c.collectExtraMap(ctx, x, known); err != nil {
+			return fmt.Errorf("map metric %s: %w", x.name, err)
+		}
+	}
+	return nil
+}
+
+// collectExtraMap reads one additional map and updates its gauges. Its
+// entries go through the same name resolution, validation, filters and
+// sampling as the counts map, and its series expire the same way.
+func (c *Collector) collectExtraMap(ctx context.Context, x *extraMap, known map[uint32]MapEntry) error {
+	m := x.source()
+	if m == nil {
+		return fmt.Errorf("no map available")
+	}
+
+	var entries []MapEntry
+	iter := m.Iterate()
+	var key, value []byte
+	for ctx.Err() == nil && iter.Next(&key, &value) {
+		e, err := c.decodeWith(x.decoder, key, value)
+		if err != nil {
+			return fmt.Errorf("decode entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("iterate map: %w", err)
+	}
+	if c.byTGID {
+		entries = aggregateByTGID(entries, procfs.GetTGID, "")
+	}
+
+	c.labelProcesses(ctx, entries, known)
+	entries = c.selectEntries(entries, "")
+
+	labelSets := make([][]string, 0, len(entries))
+	for _, e := range entries {
+		labels := c.labelValues(e)
+		for i, gauge := range x.gauges {
+			v := e.Count
+			if e.Values != nil {
+				v = e.Values[x.fields[i]]
+			}
+			gauge.WithLabelValues(labels...).Set(float64(v))
+		}
+		labelSets = append(labelSets, labels)
+	}
+	expireSeries(x.series, labelSets, c.clock.Now(), ctx.Err() == nil, c.staleGrace, x.deleteSeries)
+	return nil
+}
+
+// labelProcesses fills in the name and pod of each entry from known,
+// resolving the PIDs missing from it like the counts map entries
+func (c *Collector) labelProcesses(ctx context.Context, entries []MapEntry, known map[uint32]MapEntry) {
+	var missing []int
+	for i := range entries {
+		p, ok := known[entries[i].PID]
+		if !ok {
+			missing = append(missing, i)
+			continue
+		}
+		entries[i].Comm, entries[i].PodUID, entries[i].ContainerID = p.Comm, p.PodUID, p.ContainerID
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	resolve := make([]MapEntry, len(missing))
+	for j, i := range missing {
+		resolve[j].PID = entries[i].PID
+	}
+	c.resolveNames(ctx, resolve)
+	c.resolvePods(ctx, resolve)
+	c.validateComms(resolve)
+	for j, i := range missing {
+		r := resolve[j]
+		entries[i].Comm, entries[i].PodUID, entries[i].ContainerID = r.Comm, r.PodUID, r.ContainerID
+		if r.Comm != "pending" {
+			known[r.PID] = MapEntry{Comm: r.Comm, PodUID: r.PodUID, ContainerID: r.ContainerID}
+		}
+	}
+}
+
+// deleteSeries removes a series from the map's gauges
+func (x *extraMap) deleteSeries(labelValues []string) {
+	for _, gauge := range x.gauges {
+		gauge.DeleteLabelValues(labelValues...)
+	}
+}
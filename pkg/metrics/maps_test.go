@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+func TestCollectorExtraMaps(t *testing.T) {
+	bytesMap := newCountsMap(t, map[uint32]uint64{selfPID: 1500})
+	errorsMap := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: 16})
+	putEntry(t, errorsMap, pid32(selfPID), u64(2, 1))
+
+	c, reg := newTestCollector(t, Config{
+		CountsMap: newCountsMap(t, map[uint32]uint64{selfPID: 3}),
+		ExtraMaps: []MapMetric{
+			{Name: "tcp_bytes_by_pid", Source: func() *ebpf.Map { return bytesMap }},
+			{Name: "tcp_errors_by_pid", Source: func() *ebpf.Map { return errorsMap }, ValueDecoder: NewStructDecoder("refused", "timeout")},
+		},
+	})
+	collectNow(t, c)
+
+	self := map[string]string{"pid": fmt.Sprint(selfPID), "comm": "metrics.test"}
+	for name, want := range map[string]float64{
+		"tcp_bytes_by_pid":          1500,
+		"tcp_errors_by_pid_refused": 2,
+		"tcp_errors_by_pid_timeout": 1,
+	} {
+		f := gather(t, reg, name)
+		if f == nil {
+			t.Errorf("%s not gathered", name)
+			continue
+		}
+		if s := findMetric(f, self); s == nil || s.GetGauge().GetValue() != want {
+			t.Errorf("%s: got %v, want %v with the counts map's labels", name, s, want)
+		}
+	}
+}
+
+func TestNewExtraMapValidation(t *testing.T) {
+	source := func() *ebpf.Map { return nil }
+	for _, mm := range []MapMetric{
+		{Source: source},
+		{Name: "tcp_bytes_by_pid"},
+		{Name: "tcp_bytes_by_pid", Source: source, ValueDecoder: NewStructDecoder()},
+	} {
+		if _, err := newExtraMap(mm, []string{"pid", "comm"}, nil); err == nil {
+			t.Errorf("newExtraMap(%+v) accepted an invalid map metric", mm)
+		}
+	}
+}
+
+func TestExtraMapsFollowCountsPipeline(t *testing.T) {
+	extra := newCountsMap(t, map[uint32]uint64{1: 10, 2: 20, 3: 30})
+	c, reg := newTestCollector(t, Config{
+		CountsMap:    newCountsMap(t, map[uint32]uint64{1: 1}),
+		CommDenylist: []string{"noisy"},
+		ExtraMaps:    []MapMetric{{Name: "tcp_bytes_by_pid", Source: func() *ebpf.Map { return extra }}},
+	})
+	c.resolveName = func(pid int) string { return map[int]string{1: "a", 2: "noisy", 3: "bad\xff"}[pid] }
+
+	// The invalid name of a PID only in the extra map must not panic here
+	collectNow(t, c)
+	pids := func() map[string]string {
+		got := make(map[string]string)
+		if f := gather(t, reg, "tcp_bytes_by_pid"); f != nil {
+			for _, m := range f.GetMetric() {
+				got[labels(m)["pid"]] = labels(m)["comm"]
+			}
+		}
+		return got
+	}
+	if got, want := pids(), map[string]string{"1": "a", "3": "bad_"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("extra map series = %v, want %v without the denylisted comm", got, want)
+	}
+	if got := gather(t, reg, "ebpf_invalid_label_values_total").GetMetric()[0].GetCounter().GetValue(); got != 1 {
+		t.Errorf("invalid label values = %v, want the extra map's one", got)
+	}
+
+	// Series deleted from the extra map expire even while the counts map
+	// still holds the PID
+	for _, pid := range []uint32{1, 3} {
+		if err := extra.Delete(pid32(pid)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collectNow(t, c)
+	if got := pids(); len(got) != 0 {
+		t.Errorf("extra map series after deleting the PIDs = %v, want none", got)
+	}
+	if comms := commsOf(t, reg); !comms["a"] {
+		t.Error("counts series deleted along with the extra map's")
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// isMmapable reports whether m is an array map whose values can be read
+// through its memory mapping instead of one syscall per key
+func isMmapable(m *ebpf.Map) bool {
+	return m.Type() == ebpf.Array && m.Flags()&unix.BPF_F_MMAPABLE != 0
+}
+
+// mmapEntries reads every element of an mmapable array map from its memory
+// mapping. The array index is the key, so the layout matches iterateEntries.
+func (c *Collector) mmapEntries(ctx context.Context, m *ebpf.Map) ([]MapEntry, error) {
+	mem, err := m.Memory()
+	if err != nil {
+		return nil, fmt.Errorf("map memory: %w", err)
+	}
+
+	// The kernel lays array elements out at 8-byte aligned strides
+	valueSize := int(m.ValueSize())
+	stride := (valueSize + 7) &^ 7
+	n := int(m.MaxEntries())
+
+	buf := make([]byte, stride*n)
+	if _, err := mem.ReadAt(buf, 0); err != nil {
+		return nil, fmt.Errorf("read map memory: %w", err)
+	}
+
+	entries := make([]MapEntry, 0, n)
+	key := make([]byte, 4)
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		binary.NativeEndian.PutUint32(key, uint32(i))
+		e, err := c.decodeEntry(key, buf[i*stride:i*stride+valueSize])
+		if err != nil {
+			return nil, fmt.Errorf("decode entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+// benchEntries is the number of elements in the benchmark array maps
+const benchEntries = 4096
+
+// newBenchCollector returns a collector over a filled array map created with flags
+func newBenchCollector(b *testing.B, flags uint32) (*Collector, *ebpf.Map) {
+	b.Helper()
+	m := newTestMap(b, &ebpf.MapSpec{Type: ebpf.Array, KeySize: 4, ValueSize: 8, MaxEntries: benchEntries, Flags: flags})
+	for i := uint32(0); i < benchEntries; i++ {
+		putEntry(b, m, pid32(i), u64(uint64(i)+1))
+	}
+	c, err := NewCollector(Config{CountsMap: m, Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		b.Fatalf("NewCollector: %v", err)
+	}
+	return c, m
+}
+
+func TestMmapEntriesMatchIterate(t *testing.T) {
+	m := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Array, KeySize: 4, ValueSize: 8, MaxEntries: 8, Flags: unix.BPF_F_MMAPABLE})
+	for i := uint32(0); i < 8; i++ {
+		putEntry(t, m, pid32(i), u64(uint64(i)*10))
+	}
+	if !isMmapable(m) {
+		t.Fatal("isMmapable() = false for a BPF_F_MMAPABLE array")
+	}
+	c, err := NewCollector(Config{CountsMap: m, Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+
+	mapped, err := c.mmapEntries(context.Background(), m)
+	if err != nil {
+		t.Fatalf("mmapEntries: %v", err)
+	}
+	iterated, err := c.iterateEntries(context.Background(), m)
+	if err != nil {
+		t.Fatalf("iterateEntries: %v", err)
+	}
+	if len(mapped) != len(iterated) {
+		t.Fatalf("mmapEntries read %d entries, iterateEntries %d", len(mapped), len(iterated))
+	}
+	for i := range mapped {
+		if mapped[i].PID != iterated[i].PID || mapped[i].Count != iterated[i].Count {
+			t.Fatalf("entry %d: mmap %+v, iterate %+v", i, mapped[i], iterated[i])
+		}
+	}
+}
+
+func BenchmarkReadEntriesMmap(b *testing.B) {
+	c, m := newBenchCollector(b, unix.BPF_F_MMAPABLE)
+	ctx := context.Background()
+	for b.Loop() {
+		if _, err := c.mmapEntries(ctx, m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadEntriesSyscall(b *testing.B) {
+	c, m := newBenchCollector(b, 0)
+	ctx := context.Background()
+	for b.Loop() {
+		if _, err := c.iterateEntries(ctx, m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rogerwesterbo/ebpf-testing/internal/procfs"
+)
+
+// fakeProcRoot points procfs at a directory where pids 1 to n are named
+// proc-<pid>
+func fakeProcRoot(t *testing.T, n int) {
+	t.Helper()
+	root := t.TempDir()
+	for pid := 1; pid <= n; pid++ {
+		dir := filepath.Join(root, strconv.Itoa(pid))
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "comm"), []byte(fmt.Sprintf("proc-%d\n", pid)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orig := procfs.Root()
+	t.Cleanup(func() { procfs.SetRoot(orig) })
+	procfs.SetRoot(root)
+}
+
+func TestMaxNameResolvesPerScrape(t *testing.T) {
+	const pids = 5
+	counts := make(map[uint32]uint64, pids)
+	for pid := uint32(1); pid <= pids; pid++ {
+		counts[pid] = 1
+	}
+	m := newCountsMap(t, counts)
+
+	fakeProcRoot(t, pids)
+
+	// No NameCacheSize: the cap enables a cache itself
+	c, err := NewCollector(Config{CountsMap: m, Registerer: prometheus.NewRegistry(), MaxNameResolvesPerScrape: 2})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+
+	for round := 1; round <= 3; round++ {
+		entries, err := c.CollectNow()
+		if err != nil {
+			t.Fatalf("CollectNow: %v", err)
+		}
+		pending := 0
+		for _, e := range entries {
+			if e.Comm == "pending" {
+				pending++
+			}
+		}
+		if want := max(pids-2*round, 0); pending != want {
+			t.Errorf("round %d left %d pending, want %d", round, pending, want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+// NewCollectorFromPin creates a collector for a map pinned at pinPath by
+// another process, without loading or attaching anything. The map is opened
+// read-only unless cfg.ReadAndClear needs to delete entries, and is closed
+// by Stop.
+func NewCollectorFromPin(pinPath string, cfg Config) (*Collector, error) {
+	m, err := ebpf.LoadPinnedMap(pinPath, &ebpf.LoadPinOptions{ReadOnly: !cfg.ReadAndClear})
+	if err != nil {
+		return nil, fmt.Errorf("load pinned map %s: %w", pinPath, err)
+	}
+
+	cfg.CountsMap = m
+	cfg.CountsMapSource = nil
+	c, err := NewCollector(cfg)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	c.ownedMap = m
+	return c, nil
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewCollectorFromPin(t *testing.T) {
+	m := newCountsMap(t, map[uint32]uint64{selfPID: 4})
+	path := filepath.Join("/sys/fs/bpf", fmt.Sprintf("metrics-test-%d", os.Getpid()))
+	if err := m.Pin(path); err != nil {
+		t.Skipf("pinning map (is bpffs mounted?): %v", err)
+	}
+	t.Cleanup(func() { _ = m.Unpin() })
+
+	c, err := NewCollectorFromPin(path, Config{Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatalf("NewCollectorFromPin: %v", err)
+	}
+	entries, err := c.CollectNow()
+	if err != nil || len(entries) != 1 || entries[0].Count != 4 {
+		t.Fatalf("CollectNow = %+v, %v, want the pinned entry", entries, err)
+	}
+	c.Stop()
+	if fd := c.ownedMap.FD(); fd >= 0 {
+		t.Errorf("pinned map still open after Stop (fd %d)", fd)
+	}
+}
+
+func TestNewCollectorFromPinMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing")
+	_, err := NewCollectorFromPin(path, Config{Registerer: prometheus.NewRegistry()})
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Fatalf("NewCollectorFromPin = %v, want an error naming the path", err)
+	}
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import "testing"
+
+func TestAggregateByPort(t *testing.T) {
+	entries := []MapEntry{
+		{PID: 1, Dport: 443, Count: 2, Values: map[string]uint64{"connects": 2, "last_ns": 400}},
+		{PID: 2, Dport: 443, Count: 5, Values: map[string]uint64{"connects": 5, "last_ns": 300}},
+		{PID: 2, Dport: 80, Count: 1, Values: map[string]uint64{"connects": 1, "last_ns": 100}},
+	}
+
+	got := aggregateByPort(entries, "last_ns")
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(got), got)
+	}
+	if got[0].Dport != 80 || got[1].Dport != 443 {
+		t.Fatalf("ports = %d, %d, want 80, 443", got[0].Dport, got[1].Dport)
+	}
+	https := got[1]
+	if https.PID != 0 || https.Count != 7 || https.Values["connects"] != 7 {
+		t.Errorf("port 443 = %+v, want pid 0 counting 7", https)
+	}
+	if https.Values["last_ns"] != 400 {
+		t.Errorf("merged timestamp = %d, want the latest, 400", https.Values["last_ns"])
+	}
+}
@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// PushConfig holds the configuration for pushing metrics to a Pushgateway
+type PushConfig struct {
+	URL      string
+	Job      string
+	Interval time.Duration
+	// Gatherer supplies the pushed metrics; defaults to the default gatherer
+	Gatherer prometheus.Gatherer
+
+	// Username and Password enable HTTP basic auth when Username is set.
+	// They should come from configuration or the environment, never code.
+	Username string
+	Password string
+}
+
+// minFinalPush is the least time left before a deadline for Shutdown to
+// still attempt the final push
+const minFinalPush = 500 * time.Millisecond
+
+// Pusher periodically pushes metrics to a Pushgateway
+type Pusher struct {
+	pusher   *push.Pusher
+	interval time.Duration
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopChan chan struct{}
+	done     chan struct{}
+
+	startOnce    sync.Once
+	stopOnce     sync.Once
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// NewPusher creates a new Pushgateway pusher
+func NewPusher(cfg PushConfig) (*Pusher, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("pushgateway URL is required")
+	}
+	if cfg.Job == "" {
+		cfg.Job = "ebpf-agent"
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.Gatherer == nil {
+		cfg.Gatherer = prometheus.DefaultGatherer
+	}
+
+	p := push.New(cfg.URL, cfg.Job).Gatherer(cfg.Gatherer)
+	if cfg.Username != "" {
+		p = p.BasicAuth(cfg.Username, cfg.Password)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pusher{
+		pusher:   p,
+		interval: cfg.Interval,
+		ctx:      ctx,
+		cancel:   cancel,
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Push pushes the current metrics once
+func (p *Pusher) Push(ctx context.Context) error {
+	if err := p.pusher.PushContext(ctx); err != nil {
+		return fmt.Errorf("push: %w", err)
+	}
+	return nil
+}
+
+// Start begins pushing metrics periodically. It has no effect after the
+// first call or once Stop was called.
+func (p *Pusher) Start() {
+	p.startOnce.Do(p.start)
+}
+
+// start runs the push loop in the background until Stop
+func (p *Pusher) start() {
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(p.ctx, p.interval)
+				if err := p.Push(ctx); err != nil {
+					log.Printf("Pushgateway error: %v", err)
+				}
+				cancel()
+			case <-p.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic pushes, aborting one in flight, and waits for the
+// loop to exit. It is safe to call more than once and without Start.
+func (p *Pusher) Stop() {
+	p.stopOnce.Do(func() {
+		p.cancel()
+		close(p.stopChan)
+		// Without a loop nothing else closes done
+		p.startOnce.Do(func() { close(p.done) })
+	})
+	<-p.done
+}
+
+// Shutdown stops the periodic pushes and makes a final push under ctx so the
+// latest values reach the gateway. The final push is skipped when ctx is
+// done or too close to its deadline, so an unreachable gateway can't hold up
+// termination. It is safe to call without Start; only the first call pushes,
+// later ones return its result.
+func (p *Pusher) Shutdown(ctx context.Context) error {
+	p.shutdownOnce.Do(func() {
+		p.Stop()
+
+		if deadline, ok := ctx.Deadline(); ctx.Err() != nil || (ok && time.Until(deadline) < minFinalPush) {
+			log.Printf("Skipping final push: shutdown deadline too close")
+			return
+		}
+		p.shutdownErr = p.Push(ctx)
+	})
+	return p.shutdownErr
+}
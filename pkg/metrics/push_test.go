@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestPusher returns a Pusher for a test gateway and a count of the pushes it received
+func newTestPusher(t *testing.T) (*Pusher, *atomic.Int64) {
+	t.Helper()
+	var pushes atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "test"}))
+	p, err := NewPusher(PushConfig{URL: srv.URL, Gatherer: reg, Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewPusher: %v", err)
+	}
+	return p, &pushes
+}
+
+// returnsWithin fails the test if f doesn't return within a second
+func returnsWithin(t *testing.T, what string, f func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("%s did not return", what)
+	}
+}
+
+func TestPusherStopWithoutStart(t *testing.T) {
+	p, _ := newTestPusher(t)
+	returnsWithin(t, "Stop without Start", p.Stop)
+	returnsWithin(t, "second Stop", p.Stop)
+	// Start after Stop must not launch a loop
+	p.Start()
+	returnsWithin(t, "Stop after Start", p.Stop)
+}
+
+func TestPusherStopTwice(t *testing.T) {
+	p, _ := newTestPusher(t)
+	p.Start()
+	returnsWithin(t, "Stop", p.Stop)
+	returnsWithin(t, "second Stop", p.Stop)
+}
+
+func TestPusherShutdownOnce(t *testing.T) {
+	p, pushes := newTestPusher(t)
+	returnsWithin(t, "Shutdown without Start", func() {
+		if err := p.Shutdown(context.Background()); err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+	})
+	returnsWithin(t, "second Shutdown", func() {
+		if err := p.Shutdown(context.Background()); err != nil {
+			t.Errorf("second Shutdown: %v", err)
+		}
+	})
+	if got := pushes.Load(); got != 1 {
+		t.Fatalf("gateway received %d pushes, want one final push", got)
+	}
+}
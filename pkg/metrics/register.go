@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// registerAll registers every collector on reg, or none of them. Instead of
+// panicking like MustRegister, a clash with a metric registered by another
+// exporter is returned as an error naming the conflicting metric.
+func registerAll(reg prometheus.Registerer, collectors ...prometheus.Collector) error {
+	for i, c := range collectors {
+		err := reg.Register(c)
+		if err == nil {
+			continue
+		}
+		for _, registered := range collectors[:i] {
+			reg.Unregister(registered)
+		}
+
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return fmt.Errorf("metric %s is already registered, is another collector exporting it?", describe(c))
+		}
+		return fmt.Errorf("register metric %s: %w", describe(c), err)
+	}
+	return nil
+}
+
+// reservedLabels are added by histograms and summaries themselves
+var reservedLabels = []string{"le", "quantile"}
+
+// validateInstanceLabels checks instance labels are valid label names that
+// don't collide with the per-PID labels or const labels of any metric
+func validateInstanceLabels(instance prometheus.Labels, labelNames []string, constLabels prometheus.Labels) error {
+	for name := range instance {
+		switch {
+		case !model.LabelName(name).IsValidLegacy() || strings.HasPrefix(name, "__"):
+			return fmt.Errorf("instance label %q is not a valid label name", name)
+		case slices.Contains(reservedLabels, name):
+			return fmt.Errorf("instance label %q is reserved for histogram buckets and quantiles", name)
+		case slices.Contains(labelNames, name):
+			return fmt.Errorf("instance label %q collides with a per-PID label", name)
+		}
+		if _, ok := constLabels[name]; ok {
+			return fmt.Errorf("instance label %q collides with a const label", name)
+		}
+	}
+	return nil
+}
+
+// describe returns the descriptors of c for error messages
+func describe(c prometheus.Collector) string {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+
+	var descs []string
+	for d := range ch {
+		descs = append(descs, d.String())
+	}
+	return strings.Join(descs, ", ")
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ownFamilies returns the names of this package's metric families in g
+func ownFamilies(t *testing.T, g prometheus.Gatherer) []string {
+	t.Helper()
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	var names []string
+	for _, f := range families {
+		name := f.GetName()
+		if strings.HasPrefix(name, "tcp_") || strings.HasPrefix(name, "ebpf_") || strings.HasPrefix(name, "procfs_") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestNoDefaultRegistrationUntilConstruction(t *testing.T) {
+	if names := ownFamilies(t, prometheus.DefaultGatherer); len(names) != 0 {
+		t.Fatalf("default registry holds %v before any collector was constructed", names)
+	}
+
+	reg := prometheus.NewRegistry()
+	c, err := NewCollector(Config{CountsMap: newCountsMap(t, map[uint32]uint64{selfPID: 1}), Registerer: reg})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+
+	if names := ownFamilies(t, reg); len(names) == 0 {
+		t.Fatal("injected registry holds no metrics after construction")
+	}
+	if names := ownFamilies(t, prometheus.DefaultGatherer); len(names) != 0 {
+		t.Fatalf("constructing with an injected registry registered %v on the default registry", names)
+	}
+}
+
+func TestNewCollectorConflictingHelp(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "ebpf_distinct_comms", Help: "something else entirely"}))
+
+	_, err := NewCollector(Config{CountsMap: newCountsMap(t, nil), Registerer: reg})
+	if err == nil {
+		t.Fatal("NewCollector registered over a metric with conflicting help text")
+	}
+	if !strings.Contains(err.Error(), "ebpf_distinct_comms") {
+		t.Errorf("error = %q, want it to name the conflicting metric", err)
+	}
+	// Nothing registered before the clash is left behind
+	if names := ownFamilies(t, reg); len(names) != 1 {
+		t.Errorf("registry holds %v after the failed construction, want only the existing metric", names)
+	}
+}
+
+func TestValidateInstanceLabels(t *testing.T) {
+	labelNames := []string{"pid", "comm"}
+	constLabels := prometheus.Labels{"node": "n1"}
+	tests := []struct {
+		labels  prometheus.Labels
+		wantErr bool
+	}{
+		{prometheus.Labels{"deployment": "agent", "namespace": "kube-system"}, false},
+		{prometheus.Labels{"bad-name": "x"}, true},
+		{prometheus.Labels{"__meta": "x"}, true},
+		{prometheus.Labels{"le": "x"}, true},
+		{prometheus.Labels{"pid": "x"}, true},
+		{prometheus.Labels{"node": "x"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateInstanceLabels(tt.labels, labelNames, constLabels); (err != nil) != tt.wantErr {
+			t.Errorf("validateInstanceLabels(%v) = %v, want error %v", tt.labels, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCollectorInstanceLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c, err := NewCollector(Config{
+		CountsMap:      newCountsMap(t, map[uint32]uint64{selfPID: 1}),
+		Registerer:     reg,
+		InstanceLabels: prometheus.Labels{"deployment": "agent"},
+	})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			if labels(m)["deployment"] != "agent" {
+				t.Errorf("%s series %v lacks the instance label", f.GetName(), labels(m))
+			}
+		}
+	}
+}
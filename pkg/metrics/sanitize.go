@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/prometheus/common/model"
+)
+
+// commPlaceholder replaces bytes that are invalid or unprintable in a comm
+const commPlaceholder = '_'
+
+// sanitizeComm replaces invalid UTF-8 and non-printable characters in comm
+// with a placeholder, optionally lowercasing the result
+func sanitizeComm(comm string, lower bool) string {
+	var b strings.Builder
+	b.Grow(len(comm))
+	for i := 0; i < len(comm); {
+		r, size := utf8.DecodeRuneInString(comm[i:])
+		if (r == utf8.RuneError && size == 1) || !unicode.IsPrint(r) {
+			b.WriteRune(commPlaceholder)
+		} else {
+			b.WriteRune(r)
+		}
+		i += size
+	}
+	if lower {
+		return strings.ToLower(b.String())
+	}
+	return b.String()
+}
+
+// validateComms replaces process names that aren't valid label values,
+// which would otherwise make the exposition invalid, and counts each one
+func (c *Collector) validateComms(entries []MapEntry) {
+	for i := range entries {
+		if model.LabelValue(entries[i].Comm).IsValid() {
+			continue
+		}
+		entries[i].Comm = sanitizeComm(entries[i].Comm, false)
+		c.invalidLabels.Inc()
+	}
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSanitizeComm(t *testing.T) {
+	tests := []struct {
+		comm  string
+		lower bool
+		want  string
+	}{
+		{"nginx", false, "nginx"},
+		{"kworker/0:1", false, "kworker/0:1"},
+		{"bad\xffname", false, "bad_name"},
+		{"tab\there", false, "tab_here"},
+		{"Chrome\x00", true, "chrome_"},
+		{"Ünïcode", true, "ünïcode"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeComm(tt.comm, tt.lower); got != tt.want {
+			t.Errorf("sanitizeComm(%q, %v) = %q, want %q", tt.comm, tt.lower, got, tt.want)
+		}
+	}
+}
+
+func TestValidateComms(t *testing.T) {
+	c := &Collector{invalidLabels: prometheus.NewCounter(prometheus.CounterOpts{Name: "invalid"})}
+	entries := []MapEntry{{Comm: "nginx"}, {Comm: "bad\xffname"}, {Comm: "kworker/0:1"}}
+	c.validateComms(entries)
+
+	if entries[1].Comm != "bad_name" {
+		t.Errorf("invalid comm replaced with %q, want bad_name", entries[1].Comm)
+	}
+	if entries[0].Comm != "nginx" || entries[2].Comm != "kworker/0:1" {
+		t.Errorf("valid comms changed: %q, %q", entries[0].Comm, entries[2].Comm)
+	}
+	var m dto.Metric
+	if err := c.invalidLabels.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Errorf("invalid label values counted %v, want 1", got)
+	}
+}
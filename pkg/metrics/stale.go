@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+)
+
+// seriesState tracks when a per-PID series was last present in the map
+type seriesState struct {
+	labelValues []string
+	lastSeen    time.Time
+	seen        bool
+}
+
+// expireStale records the series of entries as seen and, when complete,
+// deletes the series that have been absent from the map for at least the
+// grace window; a zero grace deletes them on the first miss
+func (c *Collector) expireStale(entries []MapEntry, now time.Time, complete bool) {
+	if c.aggregate {
+		return
+	}
+	if c.series == nil {
+		c.series = make(map[string]*seriesState)
+	}
+	labelSets := make([][]string, 0, len(entries))
+	for _, e := range entries {
+		labelSets = append(labelSets, c.labelValues(e))
+	}
+	expireSeries(c.series, labelSets, now, complete, c.staleGrace, c.deleteSeries)
+}
+
+// expireSeries records labelSets as seen in series and, when complete,
+// removes with del the series absent for at least grace
+func expireSeries(series map[string]*seriesState, labelSets [][]string, now time.Time, complete bool, grace time.Duration, del func([]string)) {
+	for _, values := range labelSets {
+		key := strings.Join(values, "\xff")
+		st, ok := series[key]
+		if !ok {
+			st = &seriesState{labelValues: values}
+			series[key] = st
+		}
+		st.lastSeen = now
+		st.seen = complete
+	}
+	if !complete {
+		return
+	}
+
+	for key, st := range series {
+		if st.seen {
+			st.seen = false
+			continue
+		}
+		if now.Sub(st.lastSeen) < grace {
+			continue
+		}
+		del(st.labelValues)
+		delete(series, key)
+	}
+}
+
+// deleteSeries removes a per-PID series from every metric labeled from the
+// counts map
+func (c *Collector) deleteSeries(labelValues []string) {
+	for _, gauge := range c.gauges {
+		gauge.DeleteLabelValues(labelValues...)
+	}
+	if c.overThreshold != nil {
+		c.overThreshold.DeleteLabelValues(labelValues...)
+	}
+	if c.lastConnect != nil {
+		c.lastConnect.DeleteLabelValues(labelValues...)
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// commsOf returns the comm labels of the tcp_connects_by_pid series
+func commsOf(t *testing.T, reg *prometheus.Registry) map[string]bool {
+	t.Helper()
+	comms := make(map[string]bool)
+	if f := gather(t, reg, "tcp_connects_by_pid"); f != nil {
+		for _, m := range f.GetMetric() {
+			comms[labels(m)["comm"]] = true
+		}
+	}
+	return comms
+}
+
+func TestStaleSeriesDeleted(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newCountsMap(t, map[uint32]uint64{1: 1, 2: 1})
+	c, err := NewCollector(Config{CountsMap: m, Registerer: reg})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	c.resolveName = func(pid int) string { return map[int]string{1: "a", 2: "b"}[pid] }
+
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	if err := m.Delete(pid32(2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	if comms := commsOf(t, reg); !comms["a"] || comms["b"] {
+		t.Errorf("series = %v, want only a", comms)
+	}
+}
+
+func TestPendingSeriesExpire(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newCountsMap(t, map[uint32]uint64{1: 1, 2: 1})
+	c, err := NewCollector(Config{CountsMap: m, Registerer: reg, CollectionTimeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+
+	// The first name read outlasts the timeout, leaving the other PID pending
+	slow := true
+	c.resolveName = func(pid int) string {
+		if slow {
+			slow = false
+			time.Sleep(50 * time.Millisecond)
+		}
+		return "proc"
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	if !commsOf(t, reg)["pending"] {
+		t.Fatal("timed out collection published no pending series")
+	}
+
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	if comms := commsOf(t, reg); comms["pending"] || !comms["proc"] {
+		t.Errorf("series after a full collection = %v, want only proc", comms)
+	}
+}
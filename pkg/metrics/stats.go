@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rogerwesterbo/ebpf-testing/internal/procfs"
+)
+
+// startTime is the process start time reported by ebpf_agent_start_time_seconds
+var startTime = time.Now()
+
+// StartTime returns the time the agent process started
+func StartTime() time.Time {
+	return startTime
+}
+
+// RegisterStartTime exports ebpf_agent_start_time_seconds on reg. The value
+// is recorded when the package is initialized and never changes.
+func RegisterStartTime(reg prometheus.Registerer) error {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ebpf_agent_start_time_seconds",
+		Help: "Start time of the agent process since unix epoch in seconds",
+	})
+	gauge.Set(float64(startTime.UnixNano()) / 1e9)
+	return reg.Register(gauge)
+}
+
+// RegisterBPFStatsEnabled exports ebpf_bpf_stats_enabled on reg using the given reader.
+// The gauge reports 0 when the state cannot be read.
+func RegisterBPFStatsEnabled(reg prometheus.Registerer, read func() (bool, error)) error {
+	return reg.Register(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "ebpf_bpf_stats_enabled",
+			Help: "Whether kernel bpf_stats_enabled is on (1) or off (0)",
+		},
+		func() float64 {
+			enabled, err := read()
+			if err != nil || !enabled {
+				return 0
+			}
+			return 1
+		},
+	))
+}
+
+// RegisterEventsDropped exports ebpf_events_dropped_consumer_total on reg using the given reader
+func RegisterEventsDropped(reg prometheus.Registerer, read func() uint64) error {
+	return reg.Register(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "ebpf_events_dropped_consumer_total",
+			Help: "Number of ringbuf events dropped because the userspace consumer was too slow",
+		},
+		func() float64 {
+			return float64(read())
+		},
+	))
+}
+
+// RegisterOpenFDs exports ebpf_agent_open_fds on reg, read at each scrape
+// using the given reader. Nothing is exported when the count can't be read.
+func RegisterOpenFDs(reg prometheus.Registerer, read func() (int, error)) error {
+	return reg.Register(&openFDsCollector{
+		desc: prometheus.NewDesc(
+			"ebpf_agent_open_fds",
+			"Number of file descriptors open in the agent, including eBPF maps, programs and links",
+			nil, nil,
+		),
+		read: read,
+	})
+}
+
+// openFDsCollector exports the open FD count, skipping failed reads rather
+// than reporting a misleading 0
+type openFDsCollector struct {
+	desc *prometheus.Desc
+	read func() (int, error)
+}
+
+// Describe implements prometheus.Collector
+func (o *openFDsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- o.desc
+}
+
+// Collect implements prometheus.Collector
+func (o *openFDsCollector) Collect(ch chan<- prometheus.Metric) {
+	n, err := o.read()
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(o.desc, prometheus.GaugeValue, float64(n))
+}
+
+// RegisterReadySeconds exports ebpf_ready_seconds on reg, the time since
+// readiness last became true, using readySince; it is 0 while not ready
+func RegisterReadySeconds(reg prometheus.Registerer, readySince func() time.Time) error {
+	return reg.Register(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "ebpf_ready_seconds",
+			Help: "Seconds since the agent last became ready, 0 while not ready",
+		},
+		func() float64 {
+			since := readySince()
+			if since.IsZero() {
+				return 0
+			}
+			return time.Since(since).Seconds()
+		},
+	))
+}
+
+// cacheMetrics returns collectors exporting the process name cache size and hit ratio
+func cacheMetrics(cache *procfs.Cache) []prometheus.Collector {
+	return []prometheus.Collector{
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "ebpf_name_cache_size",
+				Help: "Number of process names held in the PID name cache",
+			},
+			func() float64 {
+				return float64(cache.Stats().Size)
+			},
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "ebpf_name_cache_hit_ratio",
+				Help: "Fraction of process name lookups served from the cache",
+			},
+			func() float64 {
+				return cache.Stats().HitRatio()
+			},
+		),
+	}
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gaugeValue returns the single gauge value of family name in reg
+func gaugeValue(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	t.Helper()
+	f := gather(t, reg, name)
+	if f == nil || len(f.GetMetric()) != 1 {
+		t.Fatalf("%s: got %v, want one series", name, f)
+	}
+	return f.GetMetric()[0].GetGauge().GetValue()
+}
+
+func TestRegisterStartTime(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if err := RegisterStartTime(reg); err != nil {
+		t.Fatalf("RegisterStartTime: %v", err)
+	}
+	got := gaugeValue(t, reg, "ebpf_agent_start_time_seconds")
+	if want := float64(StartTime().UnixNano()) / 1e9; got != want {
+		t.Fatalf("ebpf_agent_start_time_seconds = %v, want %v", got, want)
+	}
+	if StartTime().After(time.Now()) {
+		t.Fatal("StartTime is in the future")
+	}
+}
+
+func TestRegisterBPFStatsEnabled(t *testing.T) {
+	var enabled bool
+	var readErr error
+	reg := prometheus.NewRegistry()
+	if err := RegisterBPFStatsEnabled(reg, func() (bool, error) { return enabled, readErr }); err != nil {
+		t.Fatalf("RegisterBPFStatsEnabled: %v", err)
+	}
+
+	enabled = true
+	if got := gaugeValue(t, reg, "ebpf_bpf_stats_enabled"); got != 1 {
+		t.Errorf("enabled: got %v, want 1", got)
+	}
+	enabled = false
+	if got := gaugeValue(t, reg, "ebpf_bpf_stats_enabled"); got != 0 {
+		t.Errorf("disabled: got %v, want 0", got)
+	}
+	enabled, readErr = true, errors.New("permission denied")
+	if got := gaugeValue(t, reg, "ebpf_bpf_stats_enabled"); got != 0 {
+		t.Errorf("unreadable: got %v, want 0", got)
+	}
+}
+
+func TestRegisterOpenFDs(t *testing.T) {
+	n, readErr := 12, error(nil)
+	reg := prometheus.NewRegistry()
+	if err := RegisterOpenFDs(reg, func() (int, error) { return n, readErr }); err != nil {
+		t.Fatalf("RegisterOpenFDs: %v", err)
+	}
+	if got := gaugeValue(t, reg, "ebpf_agent_open_fds"); got != 12 {
+		t.Errorf("ebpf_agent_open_fds = %v, want 12", got)
+	}
+	readErr = errors.New("no such file")
+	if f := gather(t, reg, "ebpf_agent_open_fds"); f != nil {
+		t.Errorf("unreadable count exported %v, want no series", f)
+	}
+}
+
+func TestRegisterReadySeconds(t *testing.T) {
+	var since time.Time
+	reg := prometheus.NewRegistry()
+	if err := RegisterReadySeconds(reg, func() time.Time { return since }); err != nil {
+		t.Fatalf("RegisterReadySeconds: %v", err)
+	}
+	if got := gaugeValue(t, reg, "ebpf_ready_seconds"); got != 0 {
+		t.Errorf("not ready: got %v, want 0", got)
+	}
+	since = time.Now().Add(-time.Minute)
+	if got := gaugeValue(t, reg, "ebpf_ready_seconds"); got < 60 || got > 120 {
+		t.Errorf("ready a minute ago: got %v, want about 60", got)
+	}
+}
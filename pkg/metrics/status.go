@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CollectorStatus is the live scheduling state of the collector
+type CollectorStatus struct {
+	Interval          string    `json:"interval"`
+	LastCollection    time.Time `json:"last_collection"`
+	NextCollection    time.Time `json:"next_collection"`
+	EntriesLastScrape int       `json:"entries_last_scrape"`
+}
+
+// Status returns the collector's current interval and collection times
+func (c *Collector) Status() CollectorStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return CollectorStatus{
+		Interval:          c.interval.String(),
+		LastCollection:    c.lastCollection,
+		NextCollection:    c.nextCollection,
+		EntriesLastScrape: len(c.last),
+	}
+}
+
+// MinEntriesCheck returns a readiness check that fails until the latest
+// collection read at least min entries. A min of zero always passes.
+func (c *Collector) MinEntriesCheck(min int) func() error {
+	return func() error {
+		if n := c.Status().EntriesLastScrape; n < min {
+			return fmt.Errorf("collected %d entries, need at least %d", n, min)
+		}
+		return nil
+	}
+}
+
+// StatusHandler serves the collector status in JSON format
+func (c *Collector) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(c.Status())
+}
+
+// setNextCollection records when the loop will next collect
+func (c *Collector) setNextCollection(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextCollection = t
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMinEntriesCheck(t *testing.T) {
+	c, err := NewCollector(Config{CountsMap: newCountsMap(t, map[uint32]uint64{selfPID: 1, 999999: 2}), Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	if err := c.MinEntriesCheck(0)(); err != nil {
+		t.Errorf("min 0 before any collection: %v", err)
+	}
+	if err := c.MinEntriesCheck(1)(); err == nil {
+		t.Error("min 1 passed before any collection")
+	}
+
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+	if err := c.MinEntriesCheck(2)(); err != nil {
+		t.Errorf("min 2 after collecting 2 entries: %v", err)
+	}
+	if err := c.MinEntriesCheck(3)(); err == nil {
+		t.Error("min 3 passed after collecting 2 entries")
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	c, clock, collected := startWithClock(t, Config{
+		CountsMap:  newCountsMap(t, map[uint32]uint64{selfPID: 1}),
+		Interval:   10 * time.Second,
+		Registerer: prometheus.NewRegistry(),
+	})
+	clock.waitTickers(t, 1)
+	clock.Advance(10 * time.Second)
+	expectCollection(t, collected)
+
+	rec := httptest.NewRecorder()
+	c.StatusHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/collector", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var status CollectorStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if status.Interval != "10s" || status.EntriesLastScrape != 1 {
+		t.Errorf("status = %+v, want a 10s interval and one entry", status)
+	}
+	if !status.LastCollection.Equal(clock.Now()) || !status.NextCollection.Equal(clock.Now().Add(10*time.Second)) {
+		t.Errorf("last = %v, next = %v; want %v and 10s later", status.LastCollection, status.NextCollection, clock.Now())
+	}
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// kernelTimeToUnix converts a bpf_ktime_get_ns() value to wall-clock time.
+// The kernel clock doesn't advance while suspended, so the result drifts
+// early by the total time the host has spent suspended since boot.
+func kernelTimeToUnix(bootTime time.Time, ns uint64) time.Time {
+	return bootTime.Add(time.Duration(ns))
+}
+
+// publishTimestamps exports the last connect time of each entry that has one
+func (c *Collector) publishTimestamps(entries []MapEntry) {
+	if c.oldestAge != nil {
+		c.oldestAge.set(c.oldestTimestamp(entries))
+	}
+	if c.lastConnect == nil {
+		return
+	}
+	for _, e := range entries {
+		ns := e.Values[c.timestampField]
+		if ns == 0 {
+			continue
+		}
+		t := kernelTimeToUnix(c.bootTime, ns)
+		c.lastConnect.WithLabelValues(c.labelValues(e)...).Set(float64(t.UnixNano()) / 1e9)
+	}
+}
+
+// oldestTimestamp returns the earliest timestamp among the entries, and
+// false when none has one
+func (c *Collector) oldestTimestamp(entries []MapEntry) (time.Time, bool) {
+	var oldest uint64
+	for _, e := range entries {
+		if ns := e.Values[c.timestampField]; ns != 0 && (oldest == 0 || ns < oldest) {
+			oldest = ns
+		}
+	}
+	if oldest == 0 {
+		return time.Time{}, false
+	}
+	return kernelTimeToUnix(c.bootTime, oldest), true
+}
+
+// oldestEntryAge exports ebpf_oldest_entry_age_seconds, computed at scrape
+// time from the oldest timestamp of the last collection. Nothing is exported
+// until a collection has seen a timestamp.
+type oldestEntryAge struct {
+	desc   *prometheus.Desc
+	now    func() time.Time
+	oldest atomic.Int64 // unix nanoseconds, 0 when unknown
+}
+
+// newOldestEntryAge creates the oldest entry age collector
+func newOldestEntryAge(constLabels prometheus.Labels, now func() time.Time) *oldestEntryAge {
+	return &oldestEntryAge{
+		desc: prometheus.NewDesc(
+			"ebpf_oldest_entry_age_seconds",
+			"Age of the oldest per-entry timestamp in the eBPF map at the last collection",
+			nil,
+			constLabels,
+		),
+		now: now,
+	}
+}
+
+// set records the oldest timestamp of a collection, or clears it
+func (o *oldestEntryAge) set(t time.Time, ok bool) {
+	if !ok {
+		o.oldest.Store(0)
+		return
+	}
+	o.oldest.Store(t.UnixNano())
+}
+
+// Describe implements prometheus.Collector
+func (o *oldestEntryAge) Describe(ch chan<- *prometheus.Desc) {
+	ch <- o.desc
+}
+
+// Collect implements prometheus.Collector
+func (o *oldestEntryAge) Collect(ch chan<- prometheus.Metric) {
+	ns := o.oldest.Load()
+	if ns == 0 {
+		return
+	}
+	age := o.now().Sub(time.Unix(0, ns)).Seconds()
+	ch <- prometheus.MustNewConstMetric(o.desc, prometheus.GaugeValue, age)
+}
+
+// newLastConnectGauge creates the last_connect_timestamp_seconds gauge
+func newLastConnectGauge(labelNames []string, constLabels prometheus.Labels) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "last_connect_timestamp_seconds",
+			Help:        "Unix time of the most recent tcp_connect() call observed per PID",
+			ConstLabels: constLabels,
+		},
+		labelNames,
+	)
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ValueDecoder decodes a raw map value into one or more uint64 counters
+type ValueDecoder interface {
+	// Size is the map value size in bytes the decoder expects
+	Size() int
+	// Fields names the decoded counters; a single empty name means the
+	// value is exported under the base metric name
+	Fields() []string
+	// Decode returns one counter per field, in Fields order
+	Decode(value []byte) ([]uint64, error)
+}
+
+// Uint64Decoder decodes a plain uint64 map value
+type Uint64Decoder struct{}
+
+// Size implements ValueDecoder
+func (Uint64Decoder) Size() int { return 8 }
+
+// Fields implements ValueDecoder
+func (Uint64Decoder) Fields() []string { return []string{""} }
+
+// Decode implements ValueDecoder
+func (Uint64Decoder) Decode(value []byte) ([]uint64, error) {
+	if len(value) != 8 {
+		return nil, fmt.Errorf("value is %d bytes, expected 8", len(value))
+	}
+	return []uint64{binary.NativeEndian.Uint64(value)}, nil
+}
+
+// StructDecoder decodes a struct of consecutive uint64 fields, e.g.
+// struct { u64 bytes; u64 packets; } with fields "bytes" and "packets".
+// Each field is exported as <metric>_<field>.
+type StructDecoder struct {
+	names []string
+}
+
+// NewStructDecoder creates a decoder for a struct with the given uint64
+// fields. At least one field is required; NewCollector rejects a decoder
+// without fields.
+func NewStructDecoder(fields ...string) StructDecoder {
+	return StructDecoder{names: fields}
+}
+
+// Size implements ValueDecoder
+func (d StructDecoder) Size() int { return 8 * len(d.names) }
+
+// Fields implements ValueDecoder
+func (d StructDecoder) Fields() []string { return d.names }
+
+// Decode implements ValueDecoder
+func (d StructDecoder) Decode(value []byte) ([]uint64, error) {
+	if len(value) != d.Size() {
+		return nil, fmt.Errorf("value is %d bytes, expected %d", len(value), d.Size())
+	}
+	out := make([]uint64, len(d.names))
+	for i := range out {
+		out[i] = binary.NativeEndian.Uint64(value[i*8:])
+	}
+	return out, nil
+}
+
+// validateDecoder checks the decoder describes at least one counter
+func validateDecoder(d ValueDecoder) error {
+	if len(d.Fields()) == 0 {
+		return fmt.Errorf("value decoder has no fields")
+	}
+	if d.Size() <= 0 {
+		return fmt.Errorf("value decoder size %d is not positive", d.Size())
+	}
+	return nil
+}
+
+// metricName returns the metric name for a decoder field
+func metricName(base, field string) string {
+	if field == "" {
+		return base
+	}
+	return base + "_" + field
+}
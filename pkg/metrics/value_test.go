@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStructDecoder(t *testing.T) {
+	d := NewStructDecoder("bytes", "packets")
+	if d.Size() != 16 {
+		t.Errorf("Size() = %d, want 16", d.Size())
+	}
+	got, err := d.Decode(u64(1500, 3))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !slices.Equal(got, []uint64{1500, 3}) {
+		t.Errorf("Decode() = %v, want [1500 3]", got)
+	}
+	if _, err := d.Decode(u64(1)); err == nil {
+		t.Error("Decode accepted a short value")
+	}
+}
+
+func TestCollectorRejectsDecoderWithoutFields(t *testing.T) {
+	_, err := NewCollector(Config{Registerer: prometheus.NewRegistry(), ValueDecoder: NewStructDecoder()})
+	if err == nil {
+		t.Error("NewCollector accepted a decoder without fields")
+	}
+}
+
+func TestCollectorStructValues(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newTestMap(t, &ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: 16})
+	putEntry(t, m, pid32(selfPID), u64(1500, 3))
+	c, err := NewCollector(Config{CountsMap: m, Registerer: reg, ValueDecoder: NewStructDecoder("bytes", "packets")})
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	if _, err := c.CollectNow(); err != nil {
+		t.Fatalf("CollectNow: %v", err)
+	}
+
+	for name, want := range map[string]float64{"tcp_connects_by_pid_bytes": 1500, "tcp_connects_by_pid_packets": 3} {
+		f := gather(t, reg, name)
+		if f == nil {
+			t.Errorf("%s not gathered", name)
+			continue
+		}
+		if got := f.GetMetric()[0].GetGauge().GetValue(); got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"net"
+)
+
+// interfaceAddrs returns the addresses assigned to the named interface
+func interfaceAddrs(name string) ([]net.Addr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return iface.Addrs()
+}
+
+// resolveInterfaceIP returns the first usable IP on the named interface,
+// preferring IPv4 and skipping link-local addresses
+func resolveInterfaceIP(name string, lookup func(string) ([]net.Addr, error)) (net.IP, error) {
+	addrs, err := lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("interface %q: %w", name, err)
+	}
+
+	var v6 net.IP
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() || ipNet.IP.IsUnspecified() {
+			continue
+		}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			return ip4, nil
+		}
+		if v6 == nil {
+			v6 = ipNet.IP
+		}
+	}
+	if v6 != nil {
+		return v6, nil
+	}
+	return nil, fmt.Errorf("interface %q has no suitable IP address", name)
+}
+
+// bindAddr combines the port of addr with the IP of the named interface
+func bindAddr(addr, iface string, lookup func(string) ([]net.Addr, error)) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if iface == "" {
+		return addr, nil
+	}
+	if host != "" {
+		return "", fmt.Errorf("address %q already has a host; it cannot be combined with bind interface %q", addr, iface)
+	}
+
+	ip, err := resolveInterfaceIP(iface, lookup)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip.String(), port), nil
+}
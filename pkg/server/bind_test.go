@@ -0,0 +1,56 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// fakeAddrs returns a lookup serving addrs for any interface
+func fakeAddrs(cidrs ...string) func(string) ([]net.Addr, error) {
+	return func(string) ([]net.Addr, error) {
+		var addrs []net.Addr
+		for _, c := range cidrs {
+			ip, ipNet, err := net.ParseCIDR(c)
+			if err != nil {
+				return nil, err
+			}
+			ipNet.IP = ip
+			addrs = append(addrs, ipNet)
+		}
+		return addrs, nil
+	}
+}
+
+func TestBindAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		iface   string
+		lookup  func(string) ([]net.Addr, error)
+		want    string
+		wantErr bool
+	}{
+		{name: "no interface", addr: ":9090", want: ":9090"},
+		{name: "prefers IPv4", addr: ":9090", iface: "eth1", lookup: fakeAddrs("fd00::1/64", "10.0.0.5/24"), want: "10.0.0.5:9090"},
+		{name: "skips link-local", addr: ":9090", iface: "eth1", lookup: fakeAddrs("fe80::1/64", "fd00::1/64"), want: "[fd00::1]:9090"},
+		{name: "host already set", addr: "127.0.0.1:9090", iface: "lo", lookup: fakeAddrs("127.0.0.1/8"), wantErr: true},
+		{name: "no usable address", addr: ":9090", iface: "eth1", lookup: fakeAddrs("fe80::1/64"), wantErr: true},
+		{name: "unknown interface", addr: ":9090", iface: "nope", lookup: func(string) ([]net.Addr, error) { return nil, errors.New("no such interface") }, wantErr: true},
+		{name: "invalid address", addr: "9090", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bindAddr(tt.addr, tt.iface, tt.lookup)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("bindAddr(%q, %q) = %q, want an error", tt.addr, tt.iface, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("bindAddr(%q, %q) = %q, %v; want %q", tt.addr, tt.iface, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gatedScrapesCounter returns the counter of scrapes rejected before the
+// first collection, registered on reg. A counter already registered by a
+// previous manager is reused.
+func gatedScrapesCounter(reg prometheus.Registerer) (prometheus.Counter, error) {
+	counter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ebpf_metrics_scrapes_gated_total",
+		Help: "Number of /metrics requests rejected because no collection had completed yet",
+	})
+	if err := reg.Register(counter); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return nil, fmt.Errorf("register gated scrapes counter: %w", err)
+		}
+		existing, ok := are.ExistingCollector.(prometheus.Counter)
+		if !ok {
+			return nil, fmt.Errorf("register gated scrapes counter: registered collector is a %T", are.ExistingCollector)
+		}
+		return existing, nil
+	}
+	return counter, nil
+}
+
+// gateOnStarted returns 503 from next until the checker reports the first collection
+func gateOnStarted(next http.Handler, checker HealthProvider, gated prometheus.Counter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !checker.IsStarted() {
+			gated.Inc()
+			http.Error(w, "metrics not yet collected", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
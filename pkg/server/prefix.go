@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// normalizePrefix returns prefix with a leading and without a trailing
+// slash, or "" when no prefix is configured
+func normalizePrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// withPrefix serves h under prefix, stripping it before dispatching.
+// Requests outside the prefix get a 404.
+func withPrefix(prefix string, h http.Handler) http.Handler {
+	if prefix == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			http.NotFound(w, r)
+			return
+		}
+		if rest == "" {
+			rest = "/"
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = rest
+		r2.URL.RawPath = ""
+		h.ServeHTTP(w, r2)
+	})
+}
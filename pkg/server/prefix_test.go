@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNormalizePrefix(t *testing.T) {
+	for in, want := range map[string]string{"": "", "/": "", "agent": "/agent", "/agent/": "/agent", "//a/b//": "/a/b"} {
+		if got := normalizePrefix(in); got != want {
+			t.Errorf("normalizePrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRoutePrefix(t *testing.T) {
+	m := newTestManager(t, Config{RoutePrefix: "/agent/", PrefixHealthRoutes: true})
+
+	tests := []struct {
+		handler http.Handler
+		path    string
+		want    int
+	}{
+		{m.metricsServer.Handler, "/agent/metrics", http.StatusOK},
+		{m.metricsServer.Handler, "/metrics", http.StatusNotFound},
+		{m.healthServer.Handler, "/agent/readiness", http.StatusOK},
+		{m.healthServer.Handler, "/readiness", http.StatusNotFound},
+		{m.healthServer.Handler, "/agentx/readiness", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if got := get(tt.handler, tt.path).Code; got != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+	if body := get(m.healthServer.Handler, "/agent/liveness").Body.String(); body != "liveness" {
+		t.Errorf("GET /agent/liveness served %q, want the liveness handler", body)
+	}
+}
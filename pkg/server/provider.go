@@ -0,0 +1,18 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/rogerwesterbo/ebpf-testing/pkg/health"
+)
+
+// HealthProvider serves the health routes and reports collection progress.
+// *health.Checker implements it; tests can substitute their own.
+type HealthProvider interface {
+	ReadinessHandler(w http.ResponseWriter, r *http.Request)
+	LivenessHandler(w http.ResponseWriter, r *http.Request)
+	HealthHandler(w http.ResponseWriter, r *http.Request)
+	IsStarted() bool
+}
+
+var _ HealthProvider = (*health.Checker)(nil)
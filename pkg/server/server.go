@@ -4,39 +4,103 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/rogerwesterbo/ebpf-testing/pkg/health"
 )
 
 // Config holds the configuration for the server manager
 type Config struct {
+	// MetricsAddr is the metrics listen address; empty disables the metrics
+	// server, e.g. when metrics are pushed, while health is still served
 	MetricsAddr string
+	// MetricsPath is where metrics are served; defaults to /metrics
+	MetricsPath string
 	HealthAddr  string
-	HealthCheck *health.Checker
+	HealthCheck HealthProvider
+
+	// KeepAlive sets the TCP keep-alive period for accepted connections.
+	// Zero uses the net package default, negative disables keep-alives.
+	KeepAlive time.Duration
+
+	// MetricsBindInterface binds the metrics server to the first IP of the
+	// named interface (e.g. "lo" or an internal NIC) using the port from
+	// MetricsAddr, which must then not specify a host.
+	MetricsBindInterface string
+
+	// GateMetricsOnReady makes /metrics return 503 until the health checker
+	// reports the first successful collection, avoiding false-empty scrapes
+	GateMetricsOnReady bool
+
+	// DebugHandlers are mounted on the health server by path, e.g. "/debug/counts.csv"
+	DebugHandlers map[string]http.Handler
+
+	// MaxScrapeConcurrency limits concurrent /metrics gathers; excess
+	// scrapes get a 503. Zero means unlimited.
+	MaxScrapeConcurrency int
+
+	// Registerer receives the server's own metrics and Gatherer supplies
+	// /metrics; both default to the Prometheus default registry, which is
+	// only touched when NewManager runs, never at package init
+	Registerer prometheus.Registerer
+	Gatherer   prometheus.Gatherer
+
+	// RoutePrefix serves the metrics endpoint under a path prefix, e.g.
+	// "/agent" for /agent/metrics behind an ingress. Slashes are normalized.
+	RoutePrefix string
+	// PrefixHealthRoutes also serves the health routes under RoutePrefix
+	PrefixHealthRoutes bool
 }
 
 // Manager manages HTTP servers
 type Manager struct {
 	metricsServer *http.Server
+	metricsRoute  string
 	healthServer  *http.Server
+	listenConfig  net.ListenConfig
+	bindIface     string
 }
 
 // NewManager creates a new server manager
-func NewManager(cfg Config) *Manager {
-	// Metrics server
-	metricsServer := &http.Server{
-		Addr:              cfg.MetricsAddr,
-		ReadHeaderTimeout: 5 * time.Second,
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path == "/metrics" {
-				promhttp.Handler().ServeHTTP(w, r)
-			} else {
-				http.NotFound(w, r)
-			}
+func NewManager(cfg Config) (*Manager, error) {
+	// Metrics server; OpenMetrics is negotiated so exemplars can be exposed
+	if cfg.Registerer == nil {
+		cfg.Registerer = prometheus.DefaultRegisterer
+	}
+	if cfg.Gatherer == nil {
+		cfg.Gatherer = prometheus.DefaultGatherer
+	}
+	metricsHandler := promhttp.InstrumentMetricHandler(
+		cfg.Registerer,
+		promhttp.HandlerFor(cfg.Gatherer, promhttp.HandlerOpts{
+			EnableOpenMetrics:   true,
+			MaxRequestsInFlight: cfg.MaxScrapeConcurrency,
 		}),
+	)
+	if cfg.GateMetricsOnReady {
+		gated, err := gatedScrapesCounter(cfg.Registerer)
+		if err != nil {
+			return nil, err
+		}
+		metricsHandler = gateOnStarted(metricsHandler, cfg.HealthCheck, gated)
+	}
+
+	prefix := normalizePrefix(cfg.RoutePrefix)
+	metricsRoute := prefix + metricsPath(cfg.MetricsPath)
+	var metricsServer *http.Server
+	if cfg.MetricsAddr != "" {
+		// Any other path gets the mux's 404 without reaching promhttp
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle(metricsRoute, metricsHandler)
+		metricsServer = &http.Server{
+			Addr:              cfg.MetricsAddr,
+			ReadHeaderTimeout: 5 * time.Second,
+			Handler:           metricsMux,
+		}
 	}
 
 	// Health check server
@@ -44,33 +108,77 @@ func NewManager(cfg Config) *Manager {
 	healthMux.HandleFunc("/readiness", cfg.HealthCheck.ReadinessHandler)
 	healthMux.HandleFunc("/liveness", cfg.HealthCheck.LivenessHandler)
 	healthMux.HandleFunc("/health", cfg.HealthCheck.HealthHandler)
+	for path, h := range cfg.DebugHandlers {
+		healthMux.Handle(path, h)
+	}
 
+	var healthHandler http.Handler = healthMux
+	if cfg.PrefixHealthRoutes {
+		healthHandler = withPrefix(prefix, healthMux)
+	}
 	healthServer := &http.Server{
 		Addr:              cfg.HealthAddr,
 		ReadHeaderTimeout: 5 * time.Second,
-		Handler:           healthMux,
+		Handler:           healthHandler,
 	}
 
 	return &Manager{
 		metricsServer: metricsServer,
+		metricsRoute:  metricsRoute,
 		healthServer:  healthServer,
+		listenConfig:  net.ListenConfig{KeepAlive: cfg.KeepAlive},
+		bindIface:     cfg.MetricsBindInterface,
+	}, nil
+}
+
+// metricsPath returns path with a leading slash, or /metrics when empty
+func metricsPath(path string) string {
+	if path == "" {
+		return "/metrics"
 	}
+	return "/" + strings.TrimLeft(path, "/")
 }
 
-// Start starts both HTTP servers
+// Start starts the HTTP servers
 func (m *Manager) Start() error {
-	// Start metrics server
-	go func() {
-		log.Printf("serving metrics on %s/metrics", m.metricsServer.Addr)
-		if err := m.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("metrics server error: %v", err)
+	var metricsListener net.Listener
+	if m.metricsServer != nil {
+		addr, err := bindAddr(m.metricsServer.Addr, m.bindIface, interfaceAddrs)
+		if err != nil {
+			return fmt.Errorf("metrics address: %w", err)
 		}
-	}()
+		m.metricsServer.Addr = addr
+
+		metricsListener, err = m.listenConfig.Listen(context.Background(), "tcp", m.metricsServer.Addr)
+		if err != nil {
+			return fmt.Errorf("listen metrics: %w", err)
+		}
+	}
+
+	healthListener, err := m.listenConfig.Listen(context.Background(), "tcp", m.healthServer.Addr)
+	if err != nil {
+		if metricsListener != nil {
+			_ = metricsListener.Close()
+		}
+		return fmt.Errorf("listen health: %w", err)
+	}
+
+	// Start metrics server
+	if m.metricsServer != nil {
+		go func() {
+			log.Printf("serving metrics on %s%s", m.metricsServer.Addr, m.metricsRoute)
+			if err := m.metricsServer.Serve(metricsListener); err != nil && err != http.ErrServerClosed {
+				log.Printf("metrics server error: %v", err)
+			}
+		}()
+	} else {
+		log.Printf("metrics server disabled")
+	}
 
 	// Start health check server
 	go func() {
 		log.Printf("serving health checks on %s (/readiness, /liveness, /health)", m.healthServer.Addr)
-		if err := m.healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := m.healthServer.Serve(healthListener); err != nil && err != http.ErrServerClosed {
 			log.Printf("health server error: %v", err)
 		}
 	}()
@@ -78,23 +186,27 @@ func (m *Manager) Start() error {
 	return nil
 }
 
-// Shutdown gracefully shuts down both servers
+// Shutdown gracefully shuts down the running servers
 func (m *Manager) Shutdown(ctx context.Context) error {
 	var err error
 
 	// Shutdown both servers concurrently
 	done := make(chan error, 2)
 
-	go func() {
-		done <- m.metricsServer.Shutdown(ctx)
-	}()
+	servers := 1
+	if m.metricsServer != nil {
+		servers++
+		go func() {
+			done <- m.metricsServer.Shutdown(ctx)
+		}()
+	}
 
 	go func() {
 		done <- m.healthServer.Shutdown(ctx)
 	}()
 
-	// Wait for both to complete
-	for i := 0; i < 2; i++ {
+	// Wait for all to complete
+	for i := 0; i < servers; i++ {
 		if e := <-done; e != nil {
 			err = e
 		}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// stubHealth is a HealthProvider answering every route with its name
+type stubHealth struct {
+	started bool
+}
+
+func (s *stubHealth) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("readiness"))
+}
+
+func (s *stubHealth) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("liveness"))
+}
+
+func (s *stubHealth) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("health"))
+}
+
+func (s *stubHealth) IsStarted() bool { return s.started }
+
+// newTestManager returns a manager for cfg with a fresh registry and a started stub checker
+func newTestManager(t *testing.T, cfg Config) *Manager {
+	t.Helper()
+	if cfg.MetricsAddr == "" {
+		cfg.MetricsAddr = "127.0.0.1:0"
+	}
+	if cfg.HealthCheck == nil {
+		cfg.HealthCheck = &stubHealth{started: true}
+	}
+	if cfg.Registerer == nil {
+		reg := prometheus.NewRegistry()
+		cfg.Registerer = reg
+		if cfg.Gatherer == nil {
+			cfg.Gatherer = reg
+		}
+	}
+	m, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return m
+}
+
+// get serves a GET for path on h and returns the recorded response
+func get(h http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestMaxScrapeConcurrency(t *testing.T) {
+	const limit = 2
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		entered <- struct{}{}
+		<-release
+		return nil, nil
+	})
+	m := newTestManager(t, Config{Gatherer: gatherer, MaxScrapeConcurrency: limit})
+	h := m.metricsServer.Handler
+
+	var wg sync.WaitGroup
+	codes := make([]int, limit)
+	for i := range limit {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = get(h, "/metrics").Code
+		}()
+		<-entered
+	}
+
+	if code := get(h, "/metrics").Code; code != http.StatusServiceUnavailable {
+		t.Errorf("scrape %d while %d are in flight got %d, want 503", limit+1, limit, code)
+	}
+	close(release)
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("in-flight scrape %d got %d, want 200", i, code)
+		}
+	}
+}
+
+func TestGateMetricsOnReady(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	checker := &stubHealth{}
+	m := newTestManager(t, Config{Registerer: reg, Gatherer: reg, HealthCheck: checker, GateMetricsOnReady: true})
+	h := m.metricsServer.Handler
+
+	if code := get(h, "/metrics").Code; code != http.StatusServiceUnavailable {
+		t.Fatalf("scrape before the first collection got %d, want 503", code)
+	}
+	checker.started = true
+	if code := get(h, "/metrics").Code; code != http.StatusOK {
+		t.Fatalf("scrape after the first collection got %d, want 200", code)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() == "ebpf_metrics_scrapes_gated_total" {
+			if got := f.GetMetric()[0].GetCounter().GetValue(); got != 1 {
+				t.Fatalf("ebpf_metrics_scrapes_gated_total = %v, want 1", got)
+			}
+			return
+		}
+	}
+	t.Fatal("ebpf_metrics_scrapes_gated_total not registered")
+}
+
+func TestGatedScrapesCounterRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	first, err := gatedScrapesCounter(reg)
+	if err != nil {
+		t.Fatalf("gatedScrapesCounter: %v", err)
+	}
+	again, err := gatedScrapesCounter(reg)
+	if err != nil || again != first {
+		t.Fatalf("second registration = %v, %v, want the existing counter", again, err)
+	}
+
+	opts := prometheus.GaugeOpts{
+		Name: "ebpf_metrics_scrapes_gated_total",
+		Help: "Number of /metrics requests rejected because no collection had completed yet",
+	}
+	for name, help := range map[string]string{"other type": opts.Help, "other help": "something else"} {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: opts.Name, Help: help}, func() float64 { return 0 }))
+		if _, err := NewManager(Config{Registerer: reg, Gatherer: reg, HealthCheck: &stubHealth{}, GateMetricsOnReady: true}); err == nil {
+			t.Errorf("%s: NewManager succeeded with a conflicting collector registered", name)
+		}
+	}
+}
+
+func TestMetricsServerDisabled(t *testing.T) {
+	m, err := NewManager(Config{HealthAddr: "127.0.0.1:0", HealthCheck: &stubHealth{}, Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if m.metricsServer != nil {
+		t.Fatal("metrics server created without MetricsAddr")
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
+
+func TestMetricsPath(t *testing.T) {
+	for in, want := range map[string]string{"": "/metrics", "prom": "/prom", "//prom": "/prom", "/a/b": "/a/b"} {
+		if got := metricsPath(in); got != want {
+			t.Errorf("metricsPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	h := newTestManager(t, Config{MetricsPath: "/prom"}).metricsServer.Handler
+	for path, want := range map[string]int{"/prom": http.StatusOK, "/metrics": http.StatusNotFound, "/": http.StatusNotFound} {
+		if got := get(h, path).Code; got != want {
+			t.Errorf("GET %s = %d, want %d", path, got, want)
+		}
+	}
+}
+
+func TestStartClosesMetricsListenerOnHealthError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { busy.Close() })
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metricsAddr := free.Addr().String()
+	free.Close()
+
+	m := newTestManager(t, Config{MetricsAddr: metricsAddr, HealthAddr: busy.Addr().String(), KeepAlive: -1})
+	if m.listenConfig.KeepAlive != -1 {
+		t.Errorf("listener keep-alive = %s, want the configured -1", m.listenConfig.KeepAlive)
+	}
+	if err := m.Start(); err == nil || !strings.Contains(err.Error(), "listen health") {
+		t.Fatalf("Start() = %v, want a health listen error", err)
+	}
+	l, err := net.Listen("tcp", metricsAddr)
+	if err != nil {
+		t.Fatalf("metrics address still bound after a failed Start: %v", err)
+	}
+	l.Close()
+}
+
+func TestHealthRoutesUseProvider(t *testing.T) {
+	h := newTestManager(t, Config{}).healthServer.Handler
+	for path, want := range map[string]string{
+		"/readiness": "readiness",
+		"/liveness":  "liveness",
+		"/health":    "health",
+	} {
+		if body := get(h, path).Body.String(); body != want {
+			t.Errorf("GET %s served %q, want the %s handler", path, body, want)
+		}
+	}
+	// eBPF details are a debug route, mounted only with the debug handlers
+	if code := get(h, "/debug/ebpf").Code; code != http.StatusNotFound {
+		t.Errorf("GET /debug/ebpf = %d without debug handlers, want 404", code)
+	}
+}
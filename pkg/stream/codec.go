@@ -0,0 +1,31 @@
+package stream
+
+import (
+	"encoding/json"
+)
+
+// codecName is the content subtype of the service, sent as
+// application/grpc+ebpf-stream-json. It is unique to this package so it
+// can't be mistaken for a json codec the host application uses.
+const codecName = "ebpf-stream-json"
+
+// jsonCodec marshals messages as JSON, so the service needs no generated
+// protobuf code and snapshots match the /debug/counts format. It isn't
+// registered with grpc/encoding, which would replace a host codec of the
+// same name; the server and StreamCounts select it explicitly instead.
+type jsonCodec struct{}
+
+// Marshal implements encoding.Codec
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements encoding.Codec
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name implements encoding.Codec
+func (jsonCodec) Name() string {
+	return codecName
+}
@@ -0,0 +1,181 @@
+// Package stream serves counts map snapshots over a gRPC streaming endpoint
+package stream
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rogerwesterbo/ebpf-testing/pkg/metrics"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the fully qualified name of the gRPC service
+const ServiceName = "ebpf.stream.v1.Counts"
+
+// streamCountsMethod is the full method name of StreamCounts
+const streamCountsMethod = "/" + ServiceName + "/StreamCounts"
+
+// StreamCountsRequest starts a StreamCounts call. It has no fields yet.
+type StreamCountsRequest struct{}
+
+// Snapshot is one snapshot of the counts map sent on the stream
+type Snapshot struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Entries   []metrics.MapEntry `json:"entries"`
+}
+
+// Config holds the configuration for the stream server
+type Config struct {
+	// Addr is the gRPC listen address
+	Addr string
+	// Snapshot returns the entries of the last collection, typically
+	// Collector.Snapshot
+	Snapshot func() []metrics.MapEntry
+	// Interval between snapshots on each stream, normally the collection interval
+	Interval time.Duration
+}
+
+// Server streams counts map snapshots to gRPC clients
+type Server struct {
+	cfg  Config
+	grpc *grpc.Server
+
+	// done ends open streams on shutdown, which GracefulStop would otherwise wait for
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// serviceDesc describes the Counts service to gRPC in place of generated code
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*any)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "StreamCounts",
+		Handler:       streamCountsHandler,
+		ServerStreams: true,
+	}},
+	Metadata: "stream.go",
+}
+
+// NewServer creates a stream server
+func NewServer(cfg Config) (*Server, error) {
+	if cfg.Snapshot == nil {
+		return nil, fmt.Errorf("stream: Snapshot is required")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+
+	s := &Server{
+		cfg:  cfg,
+		grpc: grpc.NewServer(grpc.ForceServerCodec(jsonCodec{})),
+		done: make(chan struct{}),
+	}
+	s.grpc.RegisterService(&serviceDesc, s)
+	return s, nil
+}
+
+// Start listens on the configured address and serves in the background
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("listen stream: %w", err)
+	}
+	go func() {
+		log.Printf("serving %s on %s", ServiceName, lis.Addr())
+		if err := s.Serve(lis); err != nil {
+			log.Printf("stream server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Serve serves on lis until Shutdown, e.g. an in-process bufconn listener
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpc.Serve(lis)
+}
+
+// Shutdown ends open streams and stops the server, cutting connections
+// off if ctx is done before they have drained
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.done) })
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		return fmt.Errorf("stream shutdown: %w", ctx.Err())
+	}
+}
+
+// streamCountsHandler decodes the request and runs StreamCounts
+func streamCountsHandler(srv any, stream grpc.ServerStream) error {
+	var req StreamCountsRequest
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+	return srv.(*Server).streamCounts(stream)
+}
+
+// streamCounts sends a snapshot right away and then every interval until
+// the client goes away or the server shuts down
+func (s *Server) streamCounts(stream grpc.ServerStream) error {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		snap := Snapshot{Timestamp: time.Now(), Entries: s.cfg.Snapshot()}
+		if err := stream.SendMsg(&snap); err != nil {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.done:
+			return nil
+		}
+	}
+}
+
+// CountsStream receives snapshots from a StreamCounts call
+type CountsStream struct {
+	stream grpc.ClientStream
+}
+
+// StreamCounts starts a StreamCounts call on conn. The stream ends when
+// ctx is cancelled.
+func StreamCounts(ctx context.Context, conn grpc.ClientConnInterface) (*CountsStream, error) {
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], streamCountsMethod, grpc.ForceCodec(jsonCodec{}))
+	if err != nil {
+		return nil, fmt.Errorf("stream counts: %w", err)
+	}
+	if err := stream.SendMsg(&StreamCountsRequest{}); err != nil {
+		return nil, fmt.Errorf("stream counts: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, fmt.Errorf("stream counts: %w", err)
+	}
+	return &CountsStream{stream: stream}, nil
+}
+
+// Recv returns the next snapshot, or io.EOF once the server ends the stream
+func (c *CountsStream) Recv() (Snapshot, error) {
+	var snap Snapshot
+	if err := c.stream.RecvMsg(&snap); err != nil {
+		return Snapshot{}, err
+	}
+	return snap, nil
+}
@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/ebpf-testing/pkg/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startServer serves s on an in-process listener and returns a client connection
+func startServer(t *testing.T, s *Server) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = s.Serve(lis) }()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestStreamCounts(t *testing.T) {
+	entries := []metrics.MapEntry{{PID: 42, Comm: "curl", Count: 3}}
+	s, err := NewServer(Config{
+		Snapshot: func() []metrics.MapEntry { return entries },
+		Interval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	conn := startServer(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := StreamCounts(ctx, conn)
+	if err != nil {
+		t.Fatalf("StreamCounts: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		snap, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		if len(snap.Entries) != 1 || snap.Entries[0].PID != 42 || snap.Entries[0].Count != 3 {
+			t.Errorf("snapshot = %+v, want pid 42 counting 3", snap)
+		}
+		if snap.Timestamp.IsZero() {
+			t.Error("snapshot has no timestamp")
+		}
+	}
+
+	// Shutdown ends the stream cleanly rather than waiting for the client
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Errorf("Recv after Shutdown = %v, want io.EOF", err)
+			}
+			break
+		}
+	}
+}
+
+func TestCodecNotRegistered(t *testing.T) {
+	// Importing the package must not replace codecs of the host application
+	if c := encoding.GetCodecV2(codecName); c != nil {
+		t.Errorf("codec %q is registered globally", codecName)
+	}
+	if c := encoding.GetCodecV2("json"); c != nil {
+		t.Errorf("a json codec is registered globally")
+	}
+}
+
+func TestNewServerRequiresSnapshot(t *testing.T) {
+	if _, err := NewServer(Config{}); err == nil {
+		t.Error("NewServer accepted a config without Snapshot")
+	}
+}